@@ -1,17 +1,15 @@
 package main
 
 import (
-	"fmt"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"shared/bootstrap"
+	"shared/logging"
 )
 
 type Analytics struct {
@@ -41,55 +39,40 @@ var (
 )
 
 func main() {
-	initDB()
-	initRedis()
+	app := bootstrap.New("analytics-service", "8084")
 
-	r := gin.Default()
+	initDB(app)
+	redisClient = app.OpenRedis()
+
+	r := app.Router
+	app.RegisterHealth("Analytics Service OK", nil)
 
 	r.GET("/analytics/overview", getAnalyticsOverview)
 	r.GET("/analytics/project-stats", getProjectStats)
 	r.GET("/analytics/user-activity", getUserActivityStats)
 	r.GET("/analytics/task-trends", getTaskTrends)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8084"
-	}
-
-	log.Printf("Analytics service running on port %s", port)
-	log.Fatal(r.Run(":" + port))
+	app.Run()
 }
 
-func initDB() {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"), os.Getenv("DB_PORT"))
-
+func initDB(app *bootstrap.App) {
 	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err = app.OpenDB()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
 }
 
-func initRedis() {
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")),
-		Password: "",
-		DB:       0,
-	})
-}
-
 func getAnalyticsOverview(c *gin.Context) {
 	var analytics Analytics
 
 	// Базовые статистики
-	db.Table("users").Count(&analytics.TotalUsers)
-	db.Table("tasks").Count(&analytics.TotalTasks)
-	db.Table("projects").Count(&analytics.TotalProjects)
-	db.Table("tasks").Where("status = ?", "completed").Count(&analytics.CompletedTasks)
-	db.Table("tasks").Where("status = ?", "pending").Count(&analytics.PendingTasks)
-	db.Table("tasks").Where("due_date < ? AND status != ?", time.Now(), "completed").Count(&analytics.OverdueTasks)
+	db.WithContext(c).Table("users").Count(&analytics.TotalUsers)
+	db.WithContext(c).Table("tasks").Count(&analytics.TotalTasks)
+	db.WithContext(c).Table("projects").Count(&analytics.TotalProjects)
+	db.WithContext(c).Table("tasks").Where("status = ?", "completed").Count(&analytics.CompletedTasks)
+	db.WithContext(c).Table("tasks").Where("status = ?", "pending").Count(&analytics.PendingTasks)
+	db.WithContext(c).Table("tasks").Where("due_date < ? AND status != ?", time.Now(), "completed").Count(&analytics.OverdueTasks)
 
 	// Расчет процента завершения
 	if analytics.TotalTasks > 0 {
@@ -97,11 +80,11 @@ func getAnalyticsOverview(c *gin.Context) {
 	}
 
 	// Среднее время выполнения задач
-	db.Table("tasks").Select("COALESCE(AVG(estimated_hours), 0)").Scan(&analytics.AvgTaskHours)
+	db.WithContext(c).Table("tasks").Select("COALESCE(AVG(estimated_hours), 0)").Scan(&analytics.AvgTaskHours)
 
 	// Активность за последние 7 дней
 	since := time.Now().AddDate(0, 0, -7)
-	db.Table("user_activities").Where("created_at >= ?", since).Count(&analytics.RecentActivities)
+	db.WithContext(c).Table("user_activities").Where("created_at >= ?", since).Count(&analytics.RecentActivities)
 
 	c.JSON(http.StatusOK, analytics)
 }
@@ -109,7 +92,7 @@ func getAnalyticsOverview(c *gin.Context) {
 func getProjectStats(c *gin.Context) {
 	var projectStats []ProjectStats
 
-	rows, err := db.Table("projects p").
+	rows, err := db.WithContext(c).Table("projects p").
 		Select("p.id as project_id, p.name as project_name, " +
 			"COUNT(t.id) as total_tasks, " +
 			"SUM(CASE WHEN t.status = 'completed' THEN 1 ELSE 0 END) as completed, " +
@@ -160,7 +143,7 @@ func getUserActivityStats(c *gin.Context) {
 	}
 
 	// Активность по дням
-	db.Table("user_activities").
+	db.WithContext(c).Table("user_activities").
 		Select("DATE(created_at) as date, COUNT(*) as count").
 		Where("created_at >= ?", since).
 		Group("DATE(created_at)").
@@ -168,7 +151,7 @@ func getUserActivityStats(c *gin.Context) {
 		Scan(&result.DailyActivities)
 
 	// Топ пользователей по активности
-	db.Table("user_activities ua").
+	db.WithContext(c).Table("user_activities ua").
 		Select("ua.user_id, u.username, COUNT(*) as count").
 		Joins("LEFT JOIN users u ON u.id = ua.user_id").
 		Where("ua.created_at >= ?", since).
@@ -201,14 +184,14 @@ func getTaskTrends(c *gin.Context) {
 	}
 
 	// Задачи по статусам
-	db.Table("tasks").
+	db.WithContext(c).Table("tasks").
 		Select("status, COUNT(*) as count").
 		Where("created_at >= ?", since).
 		Group("status").
 		Scan(&trends.TasksByStatus)
 
 	// Задачи по приоритету
-	db.Table("tasks").
+	db.WithContext(c).Table("tasks").
 		Select("priority, COUNT(*) as count").
 		Where("created_at >= ?", since).
 		Group("priority").
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"shared/logging"
+)
+
+// Headers injected by the gateway after a token has been verified. Backend
+// services trust these headers, so any client-supplied values are stripped.
+const (
+	headerUserID   = "X-User-ID"
+	headerUserRole = "X-User-Role"
+)
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+type authConfig struct {
+	// signingKey signs new tokens; verifyKeys additionally accept tokens
+	// signed with previous keys so they can be rotated without logging
+	// everybody out.
+	signingKey []byte
+	verifyKeys [][]byte
+	issuer     string
+	ttl        time.Duration
+}
+
+type authUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	// MustChangePassword is set after an admin reset; the token then only
+	// allows changing the password.
+	MustChangePassword bool `json:"must_change_password"`
+}
+
+type userClaims struct {
+	Username           string `json:"username"`
+	Role               string `json:"role"`
+	MustChangePassword bool   `json:"must_change_password,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// credentialVerifier checks a username/password pair and returns the
+// identity that should be embedded into the issued token.
+type credentialVerifier interface {
+	Verify(ctx context.Context, username, password string) (*authUser, error)
+}
+
+func loadAuthConfig() authConfig {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		logging.Fatal("JWT_SECRET is not set")
+	}
+
+	cfg := authConfig{
+		signingKey: []byte(secret),
+		verifyKeys: [][]byte{[]byte(secret)},
+		issuer:     os.Getenv("JWT_ISSUER"),
+		ttl:        24 * time.Hour,
+	}
+
+	for _, key := range strings.Split(os.Getenv("JWT_PREVIOUS_SECRETS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			cfg.verifyKeys = append(cfg.verifyKeys, []byte(key))
+		}
+	}
+
+	if cfg.issuer == "" {
+		cfg.issuer = "api-gateway"
+	}
+
+	if raw := os.Getenv("JWT_TTL"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl <= 0 {
+			logging.Fatal("Invalid JWT_TTL", "value", raw)
+		}
+		cfg.ttl = ttl
+	}
+
+	return cfg
+}
+
+func (cfg authConfig) issueToken(user *authUser) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(cfg.ttl)
+
+	claims := userClaims{
+		Username:           user.Username,
+		Role:               user.Role,
+		MustChangePassword: user.MustChangePassword,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Issuer:    cfg.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(cfg.signingKey)
+	return token, expiresAt, err
+}
+
+func (cfg authConfig) parseToken(raw string) (*userClaims, error) {
+	var lastErr error
+	for _, key := range cfg.verifyKeys {
+		claims := &userClaims{}
+		_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+			return key, nil
+		},
+			jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+			jwt.WithIssuer(cfg.issuer),
+			jwt.WithExpirationRequired(),
+		)
+		if err == nil {
+			if _, err := strconv.ParseUint(claims.Subject, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid subject: %w", err)
+			}
+			return claims, nil
+		}
+		lastErr = err
+		if !errors.Is(err, jwt.ErrSignatureInvalid) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// stripIdentity removes identity headers supplied by the client. Backends
+// trust them, so only authenticate may set them.
+func stripIdentity(c *gin.Context) {
+	c.Request.Header.Del(headerUserID)
+	c.Request.Header.Del(headerUserRole)
+}
+
+// authenticate rejects requests without a valid bearer token and forwards
+// the caller identity to backend services as trusted headers. It reports
+// whether the request may proceed.
+func authenticate(cfg authConfig, c *gin.Context) bool {
+	if c.Request.Method == http.MethodOptions {
+		return true
+	}
+
+	raw, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok && strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		// EventSource cannot set headers, so streams may pass the token
+		// in the query string instead.
+		raw, ok = c.Query("access_token"), true
+	}
+	if !ok || raw == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="api-gateway"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return false
+	}
+
+	claims, err := cfg.parseToken(raw)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer realm="api-gateway", error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return false
+	}
+
+	if claims.MustChangePassword && !isPasswordChange(c.Request, claims.Subject) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Password change required",
+			"code":  "password_change_required",
+		})
+		return false
+	}
+
+	c.Request.Header.Set(headerUserID, claims.Subject)
+	c.Request.Header.Set(headerUserRole, claims.Role)
+	c.Set("user_id", claims.Subject)
+	c.Set("user_role", claims.Role)
+	return true
+}
+
+// isPasswordChange reports whether r changes the password of the given user,
+// the only request a token with must_change_password may make.
+func isPasswordChange(r *http.Request, subject string) bool {
+	return r.Method == http.MethodPost && path.Clean(r.URL.Path) == "/users/"+subject+"/password"
+}
+
+func loginHandler(cfg authConfig, verifier credentialVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req loginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		user, err := verifier.Verify(c.Request.Context(), req.Username, req.Password)
+		if errors.Is(err, errInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c, "Credential verification failed", "error", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Cannot verify credentials"})
+			return
+		}
+
+		token, expiresAt, err := cfg.issueToken(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot issue token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   int(time.Until(expiresAt).Seconds()),
+			"expires_at":   expiresAt.Format(time.RFC3339),
+			"user":         user,
+		})
+	}
+}
+
+// userServiceVerifier delegates credential checks to user-service. The
+// instance is chosen by the load balancer of the named upstream.
+type userServiceVerifier struct {
+	upstream string
+	client   *http.Client
+}
+
+func newUserServiceVerifier(upstream string) *userServiceVerifier {
+	return &userServiceVerifier{
+		upstream: upstream,
+		client:   &http.Client{Transport: tracedTransport, Timeout: 10 * time.Second},
+	}
+}
+
+func (v *userServiceVerifier) Verify(ctx context.Context, username, password string) (*authUser, error) {
+	up := routes.Load().upstreams[v.upstream]
+	if up == nil || len(up.instances) == 0 {
+		return nil, errors.New("user service is not configured")
+	}
+	inst := up.pick(username)
+
+	body, err := json.Marshal(loginRequest{Username: username, Password: password})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, inst.url.String()+"/users/verify", bytes.NewReader(body))
+	if err != nil {
+		inst.done(false)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(logging.HeaderRequestID, logging.RequestID(ctx))
+
+	resp, err := v.client.Do(req)
+	inst.done(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusNotFound, http.StatusLocked:
+		return nil, errInvalidCredentials
+	default:
+		return nil, fmt.Errorf("user service returned %d", resp.StatusCode)
+	}
+
+	var user authUser
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("decode user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, errors.New("user service returned no user id")
+	}
+	return &user, nil
+}
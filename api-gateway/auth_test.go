@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+var testAuth = authConfig{
+	signingKey: []byte("current-secret"),
+	verifyKeys: [][]byte{[]byte("current-secret"), []byte("previous-secret")},
+	issuer:     "api-gateway",
+	ttl:        time.Hour,
+}
+
+// useRoutes compiles cfg and makes it the current route table for the
+// duration of the test, without starting health probes.
+func useRoutes(t *testing.T, cfg routeConfig) *routeTable {
+	t.Helper()
+	table, err := compileRoutes(cfg)
+	if err != nil {
+		t.Fatalf("compileRoutes: %v", err)
+	}
+	previous := routes.Swap(table)
+	t.Cleanup(func() { routes.Store(previous) })
+	return table
+}
+
+// identityBackend answers with the identity headers it received.
+func identityBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"user_id":   r.Header.Get(headerUserID),
+			"user_role": r.Header.Get(headerUserRole),
+		})
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func newTestGateway(t *testing.T, backendURL string) *gin.Engine {
+	t.Helper()
+	useRoutes(t, routeConfig{
+		Upstreams: map[string]upstreamConfig{"backend": {URL: backendURL}},
+		Routes: []routeRule{
+			{Prefix: "/tasks", Upstream: "backend"},
+			{Prefix: "/users", Upstream: "backend"},
+			{Prefix: "/public", Upstream: "backend", Public: true},
+		},
+	})
+	r := gin.New()
+	r.NoRoute(routeHandler(testAuth))
+	return r
+}
+
+func signToken(t *testing.T, key string, claims userClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func testClaims(subject, role string, expiresIn time.Duration) userClaims {
+	now := time.Now()
+	return userClaims{
+		Username: "alice",
+		Role:     role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    testAuth.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+	}
+}
+
+func TestRouteHandlerAuthentication(t *testing.T) {
+	gateway := newTestGateway(t, identityBackend(t).URL)
+
+	valid, _, err := testAuth.issueToken(&authUser{ID: 7, Username: "alice", Role: "user"})
+	if err != nil {
+		t.Fatalf("issueToken: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+		wantUser   string
+		wantRole   string
+	}{
+		{name: "missing token", path: "/tasks", wantStatus: http.StatusUnauthorized},
+		{name: "valid token", path: "/tasks", token: valid, wantStatus: http.StatusOK, wantUser: "7", wantRole: "user"},
+		{
+			name:       "previous signing key",
+			path:       "/tasks",
+			token:      signToken(t, "previous-secret", testClaims("8", "manager", time.Hour)),
+			wantStatus: http.StatusOK, wantUser: "8", wantRole: "manager",
+		},
+		{
+			name:       "unknown signing key",
+			path:       "/tasks",
+			token:      signToken(t, "other-secret", testClaims("7", "admin", time.Hour)),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "expired token",
+			path:       "/tasks",
+			token:      signToken(t, "current-secret", testClaims("7", "user", -time.Minute)),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "non-numeric subject",
+			path:       "/tasks",
+			token:      signToken(t, "current-secret", testClaims("alice", "admin", time.Hour)),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{name: "public route", path: "/public", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			// A forged identity must never reach the backend.
+			req.Header.Set(headerUserID, "1")
+			req.Header.Set(headerUserRole, "admin")
+
+			w := httptest.NewRecorder()
+			gateway.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var got map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode backend response: %v", err)
+			}
+			if got["user_id"] != tt.wantUser || got["user_role"] != tt.wantRole {
+				t.Errorf("backend saw identity %q/%q, want %q/%q",
+					got["user_id"], got["user_role"], tt.wantUser, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestRouteHandlerRequiresPasswordChange(t *testing.T) {
+	gateway := newTestGateway(t, identityBackend(t).URL)
+	token, _, err := testAuth.issueToken(&authUser{ID: 7, Username: "alice", Role: "user", MustChangePassword: true})
+	if err != nil {
+		t.Fatalf("issueToken: %v", err)
+	}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPost, "/users/7/password", http.StatusOK},
+		{http.MethodGet, "/tasks", http.StatusForbidden},
+		{http.MethodGet, "/users/7", http.StatusForbidden},
+		{http.MethodPost, "/users/8/password", http.StatusForbidden},
+		{http.MethodPost, "/users/7/password/reset", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		gateway.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+func TestRouteHandlerHidesInternalPaths(t *testing.T) {
+	var proxied atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+	}))
+	t.Cleanup(backend.Close)
+	useRoutes(t, routeConfig{
+		Upstreams: map[string]upstreamConfig{"backend": {URL: backend.URL}},
+		Routes:    []routeRule{{Prefix: "/users", Upstream: "backend"}},
+	})
+	gateway := gin.New()
+	gateway.NoRoute(routeHandler(testAuth))
+	token, _, err := testAuth.issueToken(&authUser{ID: 3, Username: "bob", Role: "user"})
+	if err != nil {
+		t.Fatalf("issueToken: %v", err)
+	}
+
+	for _, path := range []string{"/users/verify", "/users/verify/", "/users//verify", "/users/./verify"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		gateway.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("POST %s: status = %d, want 404", path, w.Code)
+		}
+	}
+	if n := proxied.Load(); n != 0 {
+		t.Errorf("%d internal requests reached the backend", n)
+	}
+}
+
+func TestRouteHandlerStreamTokenInQuery(t *testing.T) {
+	gateway := newTestGateway(t, identityBackend(t).URL)
+	token, _, err := testAuth.issueToken(&authUser{ID: 3, Username: "bob", Role: "user"})
+	if err != nil {
+		t.Fatalf("issueToken: %v", err)
+	}
+
+	// Only event streams may pass the token in the query string.
+	for accept, want := range map[string]int{
+		"text/event-stream": http.StatusOK,
+		"application/json":  http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/tasks?access_token="+token, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		gateway.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Accept %s: status = %d, want %d", accept, w.Code, want)
+		}
+	}
+}
+
+// stubVerifier accepts a single username/password pair.
+type stubVerifier struct {
+	user     authUser
+	password string
+}
+
+func (v stubVerifier) Verify(_ context.Context, username, password string) (*authUser, error) {
+	if username != v.user.Username || password != v.password {
+		return nil, errInvalidCredentials
+	}
+	user := v.user
+	return &user, nil
+}
+
+func TestLoginHandler(t *testing.T) {
+	r := gin.New()
+	r.POST("/auth/login", loginHandler(testAuth, stubVerifier{
+		user:     authUser{ID: 5, Username: "carol", Role: "admin"},
+		password: "correct horse",
+	}))
+
+	login := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := login(`{"username":"carol","password":"wrong"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want 401", w.Code)
+	}
+	if w := login(`{"username":"carol"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing password: status = %d, want 400", w.Code)
+	}
+
+	w := login(`{"username":"carol","password":"correct horse"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	claims, err := testAuth.parseToken(resp.AccessToken)
+	if err != nil {
+		t.Fatalf("issued token does not verify: %v", err)
+	}
+	if claims.Subject != "5" || claims.Role != "admin" {
+		t.Errorf("claims = %s/%s, want 5/admin", claims.Subject, claims.Role)
+	}
+}
+
+func TestLoginCarriesMustChangePassword(t *testing.T) {
+	r := gin.New()
+	r.POST("/auth/login", loginHandler(testAuth, stubVerifier{
+		user:     authUser{ID: 6, Username: "dave", Role: "user", MustChangePassword: true},
+		password: "temporary",
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"username":"dave","password":"temporary"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	var resp struct {
+		AccessToken string   `json:"access_token"`
+		User        authUser `json:"user"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	claims, err := testAuth.parseToken(resp.AccessToken)
+	if err != nil {
+		t.Fatalf("issued token does not verify: %v", err)
+	}
+	if !claims.MustChangePassword || !resp.User.MustChangePassword {
+		t.Errorf("must_change_password lost: claim %v, user %v", claims.MustChangePassword, resp.User.MustChangePassword)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Load balancing strategies an upstream can use.
+const (
+	strategyRoundRobin       = "round_robin"
+	strategyLeastConnections = "least_connections"
+	strategyConsistentHash   = "consistent_hash"
+)
+
+const (
+	// An instance is ejected after this many consecutive failed requests.
+	ejectAfterFailures = 3
+	ejectionTime       = 30 * time.Second
+	probeInterval      = 10 * time.Second
+	// Virtual nodes per instance on the consistent hash ring.
+	ringReplicas = 100
+)
+
+// instance is a single backend of an upstream.
+type instance struct {
+	url          *url.URL
+	active       atomic.Int64
+	failures     atomic.Int32
+	ejectedUntil atomic.Int64
+	unhealthy    atomic.Bool
+}
+
+func (i *instance) available(now time.Time) bool {
+	return !i.unhealthy.Load() && now.UnixNano() >= i.ejectedUntil.Load()
+}
+
+// done records the outcome of a request to the instance. Consecutive
+// failures eject it for a while (passive health checking).
+func (i *instance) done(failed bool) {
+	i.active.Add(-1)
+	if !failed {
+		i.failures.Store(0)
+		return
+	}
+	if i.failures.Add(1) >= ejectAfterFailures {
+		i.failures.Store(0)
+		i.ejectedUntil.Store(time.Now().Add(ejectionTime).UnixNano())
+		slog.Warn("Ejecting instance after repeated failures", "instance", i.url.String(), "duration", ejectionTime.String())
+	}
+}
+
+type ringNode struct {
+	hash     uint32
+	instance *instance
+}
+
+// upstream is a named group of interchangeable backend instances.
+type upstream struct {
+	name      string
+	strategy  string
+	critical  bool
+	instances []*instance
+	ring      []ringNode
+	next      atomic.Uint64
+}
+
+func newUpstream(name string, cfg upstreamConfig) (*upstream, error) {
+	u := &upstream{name: name, strategy: cfg.Strategy, critical: cfg.Critical}
+	if u.strategy == "" {
+		u.strategy = strategyRoundRobin
+	}
+	switch u.strategy {
+	case strategyRoundRobin, strategyLeastConnections, strategyConsistentHash:
+	default:
+		return nil, fmt.Errorf("upstream %s: unknown strategy %q", name, u.strategy)
+	}
+
+	// Both url and urls may hold comma-separated lists, so a single
+	// environment variable can name several instances.
+	raw := append([]string{cfg.URL}, cfg.URLs...)
+	for _, value := range raw {
+		for _, item := range strings.Split(os.ExpandEnv(value), ",") {
+			item = strings.TrimRight(strings.TrimSpace(item), "/")
+			if item == "" {
+				continue
+			}
+			target, err := url.Parse(item)
+			if err != nil || target.Scheme == "" || target.Host == "" {
+				return nil, fmt.Errorf("upstream %s: invalid url %q", name, item)
+			}
+			u.instances = append(u.instances, &instance{url: target})
+		}
+	}
+
+	if u.strategy == strategyConsistentHash {
+		for _, inst := range u.instances {
+			for r := 0; r < ringReplicas; r++ {
+				u.ring = append(u.ring, ringNode{hash: hashKey(inst.url.String() + "#" + strconv.Itoa(r)), instance: inst})
+			}
+		}
+		sort.Slice(u.ring, func(i, j int) bool { return u.ring[i].hash < u.ring[j].hash })
+	}
+	return u, nil
+}
+
+// pick chooses an instance for a request and counts it as active; the
+// caller must call done on it. key is used by consistent hashing. If every
+// instance is ejected or unhealthy, pick still returns one rather than
+// failing outright.
+func (u *upstream) pick(key string) *instance {
+	if len(u.instances) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var chosen *instance
+	switch u.strategy {
+	case strategyLeastConnections:
+		for _, inst := range u.instances {
+			if inst.available(now) && (chosen == nil || inst.active.Load() < chosen.active.Load()) {
+				chosen = inst
+			}
+		}
+	case strategyConsistentHash:
+		h := hashKey(key)
+		start := sort.Search(len(u.ring), func(i int) bool { return u.ring[i].hash >= h })
+		for i := 0; i < len(u.ring); i++ {
+			node := u.ring[(start+i)%len(u.ring)]
+			if node.instance.available(now) {
+				chosen = node.instance
+				break
+			}
+		}
+	default:
+		n := uint64(len(u.instances))
+		offset := u.next.Add(1)
+		for i := uint64(0); i < n; i++ {
+			if inst := u.instances[(offset+i)%n]; inst.available(now) {
+				chosen = inst
+				break
+			}
+		}
+	}
+
+	if chosen == nil {
+		chosen = u.instances[u.next.Add(1)%uint64(len(u.instances))]
+	}
+	chosen.active.Add(1)
+	return chosen
+}
+
+// hashKey hashes key for the consistent hash ring. FNV alone maps keys
+// that differ only in their last bytes, such as the virtual nodes of one
+// instance, close together, so the result goes through the murmur3
+// finalizer to spread them over the ring.
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
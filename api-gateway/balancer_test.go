@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testInstance is a backend instance that answers with its name and
+// reports its readiness on /readyz.
+type testInstance struct {
+	name    string
+	server  *httptest.Server
+	hits    atomic.Int32
+	healthy atomic.Bool
+}
+
+func startInstances(t *testing.T, n int) []*testInstance {
+	t.Helper()
+	instances := make([]*testInstance, n)
+	for i := range instances {
+		inst := &testInstance{name: fmt.Sprintf("instance-%d", i)}
+		inst.healthy.Store(true)
+		inst.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == probePath {
+				if !inst.healthy.Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				return
+			}
+			inst.hits.Add(1)
+			io.WriteString(w, inst.name)
+		}))
+		t.Cleanup(inst.server.Close)
+		instances[i] = inst
+	}
+	return instances
+}
+
+func instanceURLs(instances []*testInstance) string {
+	urls := make([]string, len(instances))
+	for i, inst := range instances {
+		urls[i] = inst.server.URL
+	}
+	return strings.Join(urls, ",")
+}
+
+// newBalancedGateway routes the public prefix /svc to the instances.
+func newBalancedGateway(t *testing.T, strategy string, instances []*testInstance) (*gin.Engine, *upstream) {
+	t.Helper()
+	table := useRoutes(t, routeConfig{
+		Upstreams: map[string]upstreamConfig{"svc": {URL: instanceURLs(instances), Strategy: strategy}},
+		Routes:    []routeRule{{Prefix: "/svc", Upstream: "svc", Public: true}},
+	})
+	r := gin.New()
+	r.NoRoute(routeHandler(testAuth))
+	return r, table.upstreams["svc"]
+}
+
+func get(r http.Handler, path, userID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "192.0.2.10:5555"
+	if userID != "" {
+		req.Header.Set(headerUserID, userID)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRoundRobinSpreadsRequests(t *testing.T) {
+	instances := startInstances(t, 3)
+	gateway, _ := newBalancedGateway(t, strategyRoundRobin, instances)
+
+	for i := 0; i < 9; i++ {
+		if w := get(gateway, "/svc/items", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i, w.Code)
+		}
+	}
+	for _, inst := range instances {
+		if n := inst.hits.Load(); n != 3 {
+			t.Errorf("%s served %d requests, want 3", inst.name, n)
+		}
+	}
+}
+
+func TestLeastConnectionsPicksIdleInstance(t *testing.T) {
+	instances := startInstances(t, 3)
+	_, up := newBalancedGateway(t, strategyLeastConnections, instances)
+
+	busy := up.pick("")
+	other := up.pick("")
+	if busy == other {
+		t.Fatal("two concurrent picks chose the same instance")
+	}
+	// busy keeps its request; the other two are idle again.
+	other.done(false)
+	for i := 0; i < 5; i++ {
+		inst := up.pick("")
+		if inst == busy {
+			t.Fatalf("pick %d chose the busy instance", i)
+		}
+		inst.done(false)
+	}
+	busy.done(false)
+}
+
+func TestConsistentHashKeepsUsersOnInstance(t *testing.T) {
+	instances := startInstances(t, 3)
+	gateway, up := newBalancedGateway(t, strategyConsistentHash, instances)
+
+	// balanceKey hashes authenticated requests on "user:<id>".
+	home := map[string]*instance{}
+	for user := 1; user <= 300; user++ {
+		key := fmt.Sprintf("user:%d", user)
+		inst := up.pick(key)
+		inst.done(false)
+		home[key] = inst
+		for i := 0; i < 3; i++ {
+			again := up.pick(key)
+			again.done(false)
+			if again != inst {
+				t.Fatalf("%s moved between instances", key)
+			}
+		}
+	}
+	// Every instance gets a fair share of the users.
+	share := map[*instance]int{}
+	for _, inst := range home {
+		share[inst]++
+	}
+	for _, inst := range up.instances {
+		if share[inst] < 40 {
+			t.Errorf("%s got %d of 300 users, want at least 40", inst.url, share[inst])
+		}
+	}
+
+	// When a user's instance is ejected, the user moves and comes back later.
+	key := "user:1"
+	ejected := home[key]
+	ejected.ejectedUntil.Store(time.Now().Add(time.Minute).UnixNano())
+	moved := up.pick(key)
+	moved.done(false)
+	if moved == ejected {
+		t.Error("consistent hashing picked an ejected instance")
+	}
+	ejected.ejectedUntil.Store(0)
+	back := up.pick(key)
+	back.done(false)
+	if back != ejected {
+		t.Error("user did not return to its instance after recovery")
+	}
+
+	if w := get(gateway, "/svc/items", "1"); w.Code != http.StatusOK {
+		t.Errorf("proxied status = %d", w.Code)
+	}
+}
+
+func TestFailingInstanceIsEjected(t *testing.T) {
+	instances := startInstances(t, 2)
+	gateway, up := newBalancedGateway(t, strategyRoundRobin, instances)
+	instances[0].server.Close()
+
+	// GET requests are retried on the other instance, so clients do not
+	// notice the dead one.
+	for i := 0; i < 10; i++ {
+		if w := get(gateway, "/svc/items", ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d (%s)", i, w.Code, w.Body)
+		}
+	}
+	dead := up.instances[0]
+	if dead.available(time.Now()) {
+		t.Error("the dead instance was not ejected")
+	}
+	if n := instances[1].hits.Load(); n != 10 {
+		t.Errorf("healthy instance served %d requests, want 10", n)
+	}
+}
+
+func TestHealthProbeRemovesAndRestoresInstance(t *testing.T) {
+	instances := startInstances(t, 2)
+	_, up := newBalancedGateway(t, strategyRoundRobin, instances)
+	table := routes.Load()
+
+	instances[1].healthy.Store(false)
+	table.probeAll(context.Background())
+	for i := 0; i < 4; i++ {
+		inst := up.pick("")
+		inst.done(false)
+		if inst == up.instances[1] {
+			t.Fatal("picked an instance whose health check fails")
+		}
+	}
+
+	instances[1].healthy.Store(true)
+	table.probeAll(context.Background())
+	picked := map[*instance]bool{}
+	for i := 0; i < 4; i++ {
+		inst := up.pick("")
+		inst.done(false)
+		picked[inst] = true
+	}
+	if !picked[up.instances[1]] {
+		t.Error("a recovered instance gets no traffic")
+	}
+}
+
+func TestPickFallsBackWhenAllInstancesAreDown(t *testing.T) {
+	instances := startInstances(t, 2)
+	_, up := newBalancedGateway(t, strategyLeastConnections, instances)
+	for _, inst := range up.instances {
+		inst.unhealthy.Store(true)
+	}
+	inst := up.pick("")
+	if inst == nil {
+		t.Fatal("pick returned no instance")
+	}
+	inst.done(false)
+}
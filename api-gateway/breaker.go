@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// circuitBreaker stops sending requests to an upstream that keeps failing.
+// After threshold consecutive failures it opens for cooldown; then a single
+// trial request is let through (half-open) and its outcome decides whether
+// the breaker closes again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	trial     bool
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time // the clock; replaced in tests
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a request may proceed and, if not, how long the
+// caller should wait before trying again. Every allowed request must be
+// followed by record or release.
+func (b *circuitBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		wait := b.cooldown - b.now().Sub(b.openedAt)
+		if wait > 0 {
+			return false, wait
+		}
+		b.state = breakerHalfOpen
+		b.trial = true
+		return true, 0
+	case breakerHalfOpen:
+		if b.trial {
+			return false, time.Second
+		}
+		b.trial = true
+		return true, 0
+	}
+	return true, 0
+}
+
+// record feeds the outcome of an allowed request into the breaker.
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if success {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release gives up an allowed request without an outcome, e.g. because
+// the client went away.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	b.trial = false
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) snapshot() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := map[string]interface{}{
+		"state":    b.state.String(),
+		"failures": b.failures,
+	}
+	if b.state == breakerOpen {
+		snapshot["opened_at"] = b.openedAt.Format(time.RFC3339)
+	}
+	return snapshot
+}
+
+// isIdempotent reports whether a request may safely be sent again.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isGatewayFailure reports whether a backend status means the backend, not
+// the request, is at fault.
+func isGatewayFailure(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
+
+// backoff waits before retry number attempt using exponential backoff with
+// full jitter. It returns false if ctx ends first.
+func backoff(ctx context.Context, attempt int) bool {
+	limit := 100 * time.Millisecond << attempt
+	if limit > 2*time.Second {
+		limit = 2 * time.Second
+	}
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(limit))))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
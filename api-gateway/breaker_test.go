@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a breaker that opens after two failures, with a
+// clock the test moves by hand.
+func newTestBreaker() (*circuitBreaker, *time.Time) {
+	clock := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(2, 10*time.Second)
+	b.now = func() time.Time { return clock }
+	return b, &clock
+}
+
+// fail lets a request through and records it as failed.
+func fail(t *testing.T, b *circuitBreaker) {
+	t.Helper()
+	if ok, _ := b.allow(); !ok {
+		t.Fatalf("request refused in state %s", b.state)
+	}
+	b.record(false)
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b, _ := newTestBreaker()
+
+	fail(t, b)
+	if b.state != breakerClosed {
+		t.Fatalf("state after one failure = %s, want closed", b.state)
+	}
+	// A success in between resets the count.
+	b.allow()
+	b.record(true)
+	fail(t, b)
+	if b.state != breakerClosed {
+		t.Fatalf("state after a reset and one failure = %s, want closed", b.state)
+	}
+
+	fail(t, b)
+	if b.state != breakerOpen {
+		t.Fatalf("state after %d failures = %s, want open", b.threshold, b.state)
+	}
+	ok, wait := b.allow()
+	if ok || wait != 10*time.Second {
+		t.Errorf("allow while open = %v, %v; want refused for 10s", ok, wait)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name    string
+		success bool
+		want    breakerState
+	}{
+		{"trial succeeds", true, breakerClosed},
+		{"trial fails", false, breakerOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, clock := newTestBreaker()
+			fail(t, b)
+			fail(t, b)
+
+			*clock = clock.Add(4 * time.Second)
+			if ok, wait := b.allow(); ok || wait != 6*time.Second {
+				t.Fatalf("allow during cooldown = %v, %v; want refused for 6s", ok, wait)
+			}
+
+			*clock = clock.Add(6 * time.Second)
+			if ok, _ := b.allow(); !ok {
+				t.Fatal("trial request after the cooldown was refused")
+			}
+			if b.state != breakerHalfOpen {
+				t.Fatalf("state during the trial = %s, want half-open", b.state)
+			}
+			if ok, _ := b.allow(); ok {
+				t.Fatal("second request let through while the trial is in flight")
+			}
+
+			b.record(tt.success)
+			if b.state != tt.want {
+				t.Errorf("state after the trial = %s, want %s", b.state, tt.want)
+			}
+			if tt.want == breakerOpen && !b.openedAt.Equal(*clock) {
+				t.Errorf("reopened at %v, want %v", b.openedAt, *clock)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerReleaseFreesTheTrial(t *testing.T) {
+	b, clock := newTestBreaker()
+	fail(t, b)
+	fail(t, b)
+	*clock = clock.Add(10 * time.Second)
+
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("trial request after the cooldown was refused")
+	}
+	b.release()
+	if b.state != breakerHalfOpen {
+		t.Fatalf("state after release = %s, want half-open", b.state)
+	}
+	if ok, _ := b.allow(); !ok {
+		t.Error("no new trial allowed after the first one was released")
+	}
+	if ok, _ := b.allow(); ok {
+		t.Error("more than one trial in flight")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// healthCacheTTL is how long an aggregated health report is reused, so
+	// frequent /health polling does not multiply into backend probes.
+	healthCacheTTL = 2 * time.Second
+	probeTimeout   = 3 * time.Second
+	// probePath is the readiness endpoint of the services. Their /health
+	// always answers 200, even while the database is down.
+	probePath = "/readyz"
+	// maxHealthBody bounds how much of a backend's probe body is kept.
+	maxHealthBody = 64 << 10
+)
+
+var healthClient = &http.Client{Transport: proxyTransport, Timeout: probeTimeout}
+
+// probeResult is the outcome of one readiness probe of an instance.
+type probeResult struct {
+	URL        string          `json:"url"`
+	Healthy    bool            `json:"healthy"`
+	StatusCode int             `json:"status_code,omitempty"`
+	LatencyMs  float64         `json:"latency_ms"`
+	Error      string          `json:"error,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	CheckedAt  time.Time       `json:"checked_at"`
+}
+
+type instanceHealth struct {
+	probeResult
+	Ejected           bool  `json:"ejected"`
+	ActiveConnections int64 `json:"active_connections"`
+}
+
+type serviceHealth struct {
+	Status    string           `json:"status"`
+	Critical  bool             `json:"critical"`
+	Strategy  string           `json:"strategy"`
+	Instances []instanceHealth `json:"instances"`
+}
+
+type healthReport struct {
+	Status    string                   `json:"status"`
+	Services  map[string]serviceHealth `json:"services"`
+	Circuits  map[string]interface{}   `json:"circuits"`
+	Timestamp string                   `json:"timestamp"`
+	// ready is false when a critical service has no healthy instance.
+	ready bool
+}
+
+// healthCache holds the last report of a route table.
+type healthCache struct {
+	mu      sync.Mutex
+	report  *healthReport
+	expires time.Time
+}
+
+// probeInstance checks the readiness endpoint of an instance and updates its
+// health flag for the load balancer.
+func probeInstance(ctx context.Context, upstreamName string, inst *instance) probeResult {
+	start := time.Now()
+	result := probeResult{URL: inst.url.String(), CheckedAt: start}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, inst.url.String()+probePath, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = healthClient.Do(req); err == nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHealthBody))
+			resp.Body.Close()
+			result.StatusCode = resp.StatusCode
+			result.Healthy = resp.StatusCode == http.StatusOK
+			if json.Valid(body) {
+				result.Body = body
+			}
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	if wasHealthy := !inst.unhealthy.Swap(!result.Healthy); wasHealthy != result.Healthy {
+		slog.Info("Instance health changed", "upstream", upstreamName, "instance", inst.url.String(), "healthy", result.Healthy)
+	}
+	return result
+}
+
+// probeAll checks every instance of every upstream concurrently.
+func (t *routeTable) probeAll(ctx context.Context) map[*instance]probeResult {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[*instance]probeResult)
+	)
+	for name, up := range t.upstreams {
+		for _, inst := range up.instances {
+			wg.Add(1)
+			go func(name string, inst *instance) {
+				defer wg.Done()
+				result := probeInstance(ctx, name, inst)
+				mu.Lock()
+				results[inst] = result
+				mu.Unlock()
+			}(name, inst)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// probeLoop actively checks the upstreams until ctx is cancelled.
+func (t *routeTable) probeLoop(ctx context.Context) {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+	for {
+		t.probeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthReport probes all upstreams, reusing a report younger than
+// healthCacheTTL.
+func (t *routeTable) healthReport() *healthReport {
+	t.health.mu.Lock()
+	defer t.health.mu.Unlock()
+
+	if t.health.report != nil && time.Now().Before(t.health.expires) {
+		return t.health.report
+	}
+
+	// The report is shared, so it must not depend on the caller's request.
+	results := t.probeAll(context.Background())
+	now := time.Now()
+	report := &healthReport{
+		Status:    "OK",
+		Services:  make(map[string]serviceHealth),
+		Circuits:  make(map[string]interface{}),
+		Timestamp: now.Format(time.RFC3339),
+		ready:     true,
+	}
+
+	for name, up := range t.upstreams {
+		service := serviceHealth{
+			Status:    "UP",
+			Critical:  up.critical,
+			Strategy:  up.strategy,
+			Instances: make([]instanceHealth, 0, len(up.instances)),
+		}
+		available := 0
+		for _, inst := range up.instances {
+			if inst.available(now) {
+				available++
+			}
+			service.Instances = append(service.Instances, instanceHealth{
+				probeResult:       results[inst],
+				Ejected:           now.UnixNano() < inst.ejectedUntil.Load(),
+				ActiveConnections: inst.active.Load(),
+			})
+		}
+
+		switch {
+		case available == 0:
+			service.Status = "DOWN"
+			if up.critical {
+				report.ready = false
+			}
+			report.Status = "DEGRADED"
+			slog.Warn("Service is not healthy", "upstream", name)
+		case available < len(up.instances):
+			service.Status = "DEGRADED"
+			report.Status = "DEGRADED"
+		}
+		report.Services[name] = service
+	}
+	if !report.ready {
+		report.Status = "DOWN"
+	}
+
+	for _, route := range t.routes {
+		report.Circuits[route.Prefix] = route.breaker.snapshot()
+	}
+
+	t.health.report = report
+	t.health.expires = time.Now().Add(healthCacheTTL)
+	return report
+}
+
+// healthHandler reports the state of every upstream. It answers 503 when a
+// critical service has no healthy instance.
+func healthHandler(c *gin.Context) {
+	report := routes.Load().healthReport()
+	status := http.StatusOK
+	if !report.ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// livezHandler only tells whether the gateway process is serving requests.
+func livezHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "OK"})
+}
+
+// readyzHandler tells whether the gateway can serve traffic, i.e. every
+// critical service has at least one healthy instance.
+func readyzHandler(c *gin.Context) {
+	report := routes.Load().healthReport()
+	if !report.ready {
+		var down []string
+		for name, service := range report.Services {
+			if service.Critical && service.Status == "DOWN" {
+				down = append(down, name)
+			}
+		}
+		sort.Strings(down)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "NOT_READY", "unavailable": down})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "READY"})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var upstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_upstream_requests_total",
+	Help: "Proxied requests to upstream instances, by outcome.",
+}, []string{"upstream", "instance", "result"})
+
+// recordUpstreamResult counts the outcome of an attempt. Retries are counted
+// separately, so the error rate reflects what the instances actually did.
+func recordUpstreamResult(a *attempt) {
+	result := "ok"
+	switch {
+	case errors.Is(a.err, errAttemptTimeout):
+		result = "timeout"
+	case errors.Is(a.err, context.Canceled):
+		result = "canceled"
+	case a.err != nil:
+		result = "connection_error"
+	case a.resp.StatusCode >= 500:
+		result = "http_" + strconv.Itoa(a.resp.StatusCode)
+	}
+	upstreamRequests.WithLabelValues(a.up, a.inst.url.Host, result).Inc()
+}
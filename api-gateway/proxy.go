@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"shared/logging"
+	"shared/telemetry"
+)
+
+// proxyTransport is shared by all routes so connections to the backends are
+// pooled and reused instead of being dialed for every request.
+var proxyTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:        256,
+	MaxIdleConnsPerHost: 64,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// tracedTransport adds client spans and trace context propagation to
+// proxied requests.
+var tracedTransport = telemetry.Transport(proxyTransport)
+
+// hopHeaders apply to a single connection and must not be forwarded
+// (RFC 9110, section 7.6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 32*1024)
+		return &buf
+	},
+}
+
+// maxReplayBody is the largest request body buffered so that an idempotent
+// request can be retried. Larger or unsized bodies are streamed once.
+const maxReplayBody = 1 << 20
+
+var errAttemptTimeout = errors.New("upstream did not respond in time")
+
+// proxyPolicy controls how a route talks to its upstream.
+type proxyPolicy struct {
+	// timeout bounds the wait for response headers of each attempt; the
+	// body may stream for longer.
+	timeout time.Duration
+	retries int
+	breaker *circuitBreaker
+}
+
+func createProxyHandler(up *upstream, policy proxyPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Without instances the service is not configured
+		if len(up.instances) == 0 {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "Service is not configured",
+			})
+			return
+		}
+
+		if ok, wait := policy.breaker.allow(); !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":       "Service is temporarily unavailable",
+				"retry_after": seconds,
+			})
+			return
+		}
+
+		body, replayable, err := requestBody(c.Request)
+		if err != nil {
+			policy.breaker.release()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot read request body"})
+			return
+		}
+		retries := 0
+		if replayable && isIdempotent(c.Request.Method) {
+			retries = policy.retries
+		}
+
+		ctx := c.Request.Context()
+		a := startAttempt(c, up, policy.timeout, body)
+		for i := 0; i < retries && a.failed() && ctx.Err() == nil; i++ {
+			a.close()
+			if !backoff(ctx, i) {
+				break
+			}
+			slog.InfoContext(c, "Retrying request", "method", c.Request.Method, "path", c.Request.URL.Path, "attempt", i+2)
+			a = startAttempt(c, up, policy.timeout, body)
+		}
+		defer a.close()
+
+		if ctx.Err() != nil {
+			// The client went away; there is nobody left to answer.
+			policy.breaker.release()
+			c.Abort()
+			return
+		}
+		policy.breaker.record(!a.failed())
+
+		if a.err != nil {
+			writeProxyError(c, a.err, a.target)
+			return
+		}
+
+		resp := a.resp
+		removeHopHeaders(resp.Header)
+		// The gateway already answers with the same request ID.
+		resp.Header.Del(logging.HeaderRequestID)
+		for key, values := range resp.Header {
+			for _, value := range values {
+				c.Writer.Header().Add(key, value)
+			}
+		}
+		c.Status(resp.StatusCode)
+		copyResponse(c, resp)
+	}
+}
+
+// requestBody returns a function producing the body for each attempt. Small
+// bodies are buffered so the request can be replayed.
+func requestBody(r *http.Request) (func() io.ReadCloser, bool, error) {
+	if r.ContentLength == 0 {
+		return func() io.ReadCloser { return http.NoBody }, true, nil
+	}
+	if r.ContentLength < 0 || r.ContentLength > maxReplayBody || !isIdempotent(r.Method) {
+		return func() io.ReadCloser { return r.Body }, false, nil
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return func() io.ReadCloser { return io.NopCloser(bytes.NewReader(data)) }, true, nil
+}
+
+// attempt is one round trip to an upstream instance.
+type attempt struct {
+	up     string
+	inst   *instance
+	target string
+	resp   *http.Response
+	err    error
+	cancel context.CancelCauseFunc
+}
+
+func startAttempt(c *gin.Context, up *upstream, timeout time.Duration, body func() io.ReadCloser) *attempt {
+	a := &attempt{up: up.name, inst: up.pick(balanceKey(c))}
+
+	// Keep the full path and query string of the original request
+	proxyURL := *a.inst.url
+	proxyURL.Path = singleJoiningSlash(a.inst.url.Path, c.Request.URL.Path)
+	proxyURL.RawQuery = c.Request.URL.RawQuery
+	a.target = proxyURL.String()
+
+	slog.DebugContext(c, "Proxying request", "method", c.Request.Method, "path", c.Request.URL.Path, "target", a.target)
+
+	// The backend request is cancelled when the client goes away.
+	ctx, cancel := context.WithCancelCause(c.Request.Context())
+	a.cancel = cancel
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, a.target, body())
+	if err != nil {
+		a.err = err
+		return a
+	}
+	req.ContentLength = c.Request.ContentLength
+	req.Header = c.Request.Header.Clone()
+	removeHopHeaders(req.Header)
+	setForwardedHeaders(c.Request, req.Header)
+
+	timer := time.AfterFunc(timeout, func() { cancel(errAttemptTimeout) })
+	a.resp, a.err = tracedTransport.RoundTrip(req)
+	if !timer.Stop() && errors.Is(context.Cause(ctx), errAttemptTimeout) {
+		if a.resp != nil {
+			a.resp.Body.Close()
+			a.resp = nil
+		}
+		a.err = errAttemptTimeout
+	}
+	return a
+}
+
+func (a *attempt) failed() bool {
+	return a.err != nil || isGatewayFailure(a.resp.StatusCode)
+}
+
+// close releases the attempt and reports its outcome to the instance.
+// Requests cancelled by the client do not count against the instance.
+func (a *attempt) close() {
+	if a.resp != nil {
+		a.resp.Body.Close()
+	}
+	a.cancel(nil)
+	a.inst.done(a.failed() && !errors.Is(a.err, context.Canceled))
+	recordUpstreamResult(a)
+}
+
+// balanceKey keeps a user on the same instance under consistent hashing;
+// anonymous requests are keyed by client IP.
+func balanceKey(c *gin.Context) string {
+	if id := c.GetHeader(headerUserID); id != "" {
+		return "user:" + id
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func removeHopHeaders(h http.Header) {
+	// Headers listed in Connection are hop-by-hop as well.
+	for _, field := range h.Values("Connection") {
+		for _, name := range strings.Split(field, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+func setForwardedHeaders(in *http.Request, h http.Header) {
+	if ip, _, err := net.SplitHostPort(in.RemoteAddr); err == nil {
+		if prior := h.Get("X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		h.Set("X-Forwarded-For", ip)
+	}
+
+	if h.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if in.TLS != nil {
+			proto = "https"
+		}
+		h.Set("X-Forwarded-Proto", proto)
+	}
+
+	if h.Get("X-Forwarded-Host") == "" {
+		h.Set("X-Forwarded-Host", in.Host)
+	}
+}
+
+// copyResponse streams the backend body to the client. Responses of
+// unknown length, such as Server-Sent Events, are flushed after every read
+// so nothing is held back in buffers.
+func copyResponse(c *gin.Context, resp *http.Response) {
+	bufp := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(bufp)
+	buf := *bufp
+
+	flush := resp.ContentLength < 0 ||
+		strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	if !flush {
+		io.CopyBuffer(c.Writer, resp.Body, buf)
+		return
+	}
+
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeProxyError(c *gin.Context, err error, target string) {
+	if errors.Is(err, errAttemptTimeout) || isTimeout(err) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error":       "Service did not respond in time",
+			"service_url": target,
+		})
+		return
+	}
+	c.JSON(http.StatusBadGateway, gin.H{
+		"error":       "Cannot connect to service: " + err.Error(),
+		"service_url": target,
+	})
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func singleJoiningSlash(a, b string) string {
+	switch {
+	case strings.HasSuffix(a, "/") && strings.HasPrefix(b, "/"):
+		return a + b[1:]
+	case !strings.HasSuffix(a, "/") && !strings.HasPrefix(b, "/"):
+		return a + "/" + b
+	}
+	return a + b
+}
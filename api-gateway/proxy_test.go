@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestProxy(t testing.TB, backendURL string) gin.HandlerFunc {
+	t.Helper()
+	up, err := newUpstream("backend", upstreamConfig{URL: backendURL})
+	if err != nil {
+		t.Fatalf("newUpstream: %v", err)
+	}
+	return createProxyHandler(up, proxyPolicy{
+		timeout: 10 * time.Second,
+		breaker: newCircuitBreaker(defaultBreakerFailures, defaultBreakerCooldown),
+	})
+}
+
+func TestProxyForwarding(t *testing.T) {
+	var got *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Clone(r.Context())
+		w.Header().Set("Proxy-Authenticate", "Basic")
+		w.Header().Set("X-Backend", "yes")
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	r := gin.New()
+	r.NoRoute(newTestProxy(t, backend.URL))
+
+	req := httptest.NewRequest(http.MethodGet, "/tasks/1?include=comments&limit=5", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	req.Header.Set("Connection", "X-Client-Hop")
+	req.Header.Set("X-Client-Hop", "drop me")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("response = %d %q", w.Code, w.Body)
+	}
+	if got.URL.Path != "/tasks/1" || got.URL.RawQuery != "include=comments&limit=5" {
+		t.Errorf("backend saw %s", got.URL)
+	}
+	for _, name := range []string{"X-Client-Hop", "Keep-Alive"} {
+		if got.Header.Get(name) != "" {
+			t.Errorf("hop-by-hop header %s reached the backend", name)
+		}
+	}
+	if xff := got.Header.Get("X-Forwarded-For"); xff != "198.51.100.1, 203.0.113.7" {
+		t.Errorf("X-Forwarded-For = %q", xff)
+	}
+	if proto := got.Header.Get("X-Forwarded-Proto"); proto != "http" {
+		t.Errorf("X-Forwarded-Proto = %q", proto)
+	}
+	if w.Header().Get("Proxy-Authenticate") != "" || w.Header().Get("X-Backend") != "yes" {
+		t.Errorf("response headers = %v", w.Header())
+	}
+}
+
+// legacyProxyHandler is the proxy the gateway used before connection
+// pooling: a new client per request, every header copied as is, the query
+// string and the client's context dropped. It is kept only to compare
+// throughput in BenchmarkProxy.
+func legacyProxyHandler(targetURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		target, err := url.Parse(targetURL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		proxyURL := target.ResolveReference(&url.URL{Path: c.Request.URL.Path})
+		req, err := http.NewRequest(c.Request.Method, proxyURL.String(), c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for key, values := range c.Request.Header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		defer resp.Body.Close()
+		for key, values := range resp.Header {
+			for _, value := range values {
+				c.Header(key, value)
+			}
+		}
+		c.Status(resp.StatusCode)
+		io.Copy(c.Writer, resp.Body)
+	}
+}
+
+// BenchmarkProxy compares the legacy proxy with the pooled, streaming one
+// under parallel load:
+//
+//	go test -run '^$' -bench Proxy -benchmem ./...
+func BenchmarkProxy(b *testing.B) {
+	payload := strings.Repeat(`{"id":1,"title":"task"},`, 400)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, payload)
+	}))
+	defer backend.Close()
+
+	handlers := []struct {
+		name    string
+		handler gin.HandlerFunc
+	}{
+		{"legacy", legacyProxyHandler(backend.URL)},
+		{"pooled", newTestProxy(b, backend.URL)},
+	}
+	for _, h := range handlers {
+		b.Run(h.name, func(b *testing.B) {
+			r := gin.New()
+			r.NoRoute(h.handler)
+			b.SetBytes(int64(len(payload)))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					req := httptest.NewRequest(http.MethodGet, "/tasks?limit=50", nil)
+					req.RemoteAddr = "192.0.2.1:1234"
+					w := httptest.NewRecorder()
+					r.ServeHTTP(w, req)
+					if w.Code != http.StatusOK {
+						b.Errorf("status = %d", w.Code)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"shared/bootstrap"
+	"shared/logging"
+)
+
+// rateLimitConfig allows Requests per Per on average, with bursts of up to
+// Burst requests (defaults to Requests).
+type rateLimitConfig struct {
+	Requests int           `yaml:"requests" json:"requests"`
+	Per      time.Duration `yaml:"per" json:"per"`
+	Burst    int           `yaml:"burst" json:"burst"`
+}
+
+// rateLimit is a token bucket: it holds up to capacity tokens and refills
+// at rate tokens per second.
+type rateLimit struct {
+	capacity float64
+	rate     float64
+}
+
+func (cfg rateLimitConfig) compile() (*rateLimit, error) {
+	if cfg.Requests <= 0 {
+		return nil, nil
+	}
+	if cfg.Per <= 0 {
+		return nil, fmt.Errorf("rate limit of %d requests needs a positive period", cfg.Requests)
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = cfg.Requests
+	}
+	return &rateLimit{capacity: float64(burst), rate: float64(cfg.Requests) / cfg.Per.Seconds()}, nil
+}
+
+type rateDecision struct {
+	allowed bool
+	// tokens left in the bucket after this request
+	tokens float64
+}
+
+// rateLimiter takes one token from the bucket identified by key.
+type rateLimiter interface {
+	Take(ctx context.Context, key string, limit *rateLimit) (rateDecision, error)
+}
+
+var limiter rateLimiter = newMemoryLimiter()
+
+// initRateLimiter selects the limiter backend from RATE_LIMIT_STORE:
+// "memory" (default) keeps buckets per gateway replica, "redis" shares
+// them between replicas.
+func initRateLimiter(app *bootstrap.App) {
+	switch store := os.Getenv("RATE_LIMIT_STORE"); store {
+	case "", "memory":
+	case "redis":
+		limiter = &redisLimiter{client: app.OpenRedis()}
+		slog.Info("Rate limits are shared through Redis")
+	default:
+		logging.Fatal("Unknown RATE_LIMIT_STORE", "value", store)
+	}
+}
+
+// checkRateLimit applies limit to the caller within scope, usually the
+// route prefix. The caller is identified by user ID when authenticated and
+// by client IP otherwise. It sets the RateLimit-* headers and reports
+// whether the request may proceed; a nil limit allows everything.
+func checkRateLimit(c *gin.Context, scope string, limit *rateLimit) bool {
+	if limit == nil {
+		return true
+	}
+
+	identity := "ip:" + c.ClientIP()
+	if id := c.GetHeader(headerUserID); id != "" {
+		identity = "user:" + id
+	}
+	decision, err := limiter.Take(c.Request.Context(), "ratelimit:"+scope+":"+identity, limit)
+	if err != nil {
+		// Failing open keeps the gateway usable when the store is down.
+		slog.WarnContext(c, "Rate limiter unavailable", "error", err)
+		return true
+	}
+
+	// Seconds until the bucket is full again.
+	reset := math.Ceil((limit.capacity - decision.tokens) / limit.rate)
+	c.Header("RateLimit-Limit", strconv.Itoa(int(limit.capacity)))
+	c.Header("RateLimit-Remaining", strconv.Itoa(int(math.Floor(decision.tokens))))
+	c.Header("RateLimit-Reset", strconv.Itoa(int(reset)))
+
+	if decision.allowed {
+		return true
+	}
+	retryAfter := int(math.Ceil((1 - decision.tokens) / limit.rate))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many requests",
+		"retry_after": retryAfter,
+	})
+	return false
+}
+
+// loginRateLimit limits login attempts per client IP, which slows down
+// password guessing. The limit comes from the current route table.
+func loginRateLimit(c *gin.Context) {
+	// Login requests carry no identity; a forged one must not pick the bucket.
+	stripIdentity(c)
+	checkRateLimit(c, "/auth/login", routes.Load().loginLimit)
+}
+
+// memoryLimiter keeps buckets in process memory.
+type memoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newMemoryLimiter() *memoryLimiter {
+	return &memoryLimiter{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+func (m *memoryLimiter) Take(_ context.Context, key string, limit *rateLimit) (rateDecision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.capacity, updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(limit.capacity, b.tokens+now.Sub(b.updated).Seconds()*limit.rate)
+	b.updated = now
+
+	decision := rateDecision{tokens: b.tokens}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision = rateDecision{allowed: true, tokens: b.tokens}
+	}
+
+	// Drop buckets idle long enough to have refilled completely.
+	if now.Sub(m.lastSweep) > time.Minute {
+		for k, idle := range m.buckets {
+			if now.Sub(idle.updated) > 10*time.Minute {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	return decision, nil
+}
+
+// takeTokenScript implements the token bucket atomically in Redis, using
+// the Redis clock so replicas with skewed clocks agree.
+var takeTokenScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('EXPIRE', KEYS[1], math.ceil(capacity / rate) + 1)
+return {allowed, tostring(tokens)}
+`)
+
+// redisLimiter shares buckets between gateway replicas.
+type redisLimiter struct {
+	client *redis.Client
+}
+
+func (r *redisLimiter) Take(ctx context.Context, key string, limit *rateLimit) (rateDecision, error) {
+	result, err := takeTokenScript.Run(ctx, r.client, []string{key}, limit.capacity, limit.rate).Slice()
+	if err != nil {
+		return rateDecision{}, err
+	}
+	if len(result) != 2 {
+		return rateDecision{}, fmt.Errorf("unexpected rate limit reply %v", result)
+	}
+	allowed, _ := result[0].(int64)
+	raw, _ := result[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return rateDecision{}, err
+	}
+	return rateDecision{allowed: allowed == 1, tokens: tokens}, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useMemoryLimiter gives the test its own empty in-memory limiter.
+func useMemoryLimiter(t *testing.T) *memoryLimiter {
+	t.Helper()
+	memory := newMemoryLimiter()
+	previous := limiter
+	limiter = memory
+	t.Cleanup(func() { limiter = previous })
+	return memory
+}
+
+func TestRateLimitConfigCompile(t *testing.T) {
+	limit, err := rateLimitConfig{Requests: 60, Per: time.Minute}.compile()
+	if err != nil || limit.capacity != 60 || limit.rate != 1 {
+		t.Errorf("compile = %+v, %v; want capacity 60, rate 1", limit, err)
+	}
+	limit, err = rateLimitConfig{Requests: 60, Per: time.Minute, Burst: 10}.compile()
+	if err != nil || limit.capacity != 10 {
+		t.Errorf("compile with burst = %+v, %v; want capacity 10", limit, err)
+	}
+	if limit, err := (rateLimitConfig{}).compile(); limit != nil || err != nil {
+		t.Errorf("zero config = %+v, %v; want no limit", limit, err)
+	}
+	if _, err := (rateLimitConfig{Requests: 5}).compile(); err == nil {
+		t.Error("a limit without a period compiled")
+	}
+}
+
+func TestMemoryLimiterBucket(t *testing.T) {
+	memory := useMemoryLimiter(t)
+	ctx := context.Background()
+	limit := &rateLimit{capacity: 3, rate: 1}
+
+	for i := 0; i < 3; i++ {
+		if d, _ := memory.Take(ctx, "k", limit); !d.allowed {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	if d, _ := memory.Take(ctx, "k", limit); d.allowed {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if d, _ := memory.Take(ctx, "other", limit); !d.allowed {
+		t.Error("buckets are not separated by key")
+	}
+
+	// Two seconds later two tokens have been refilled.
+	memory.buckets["k"].updated = memory.buckets["k"].updated.Add(-2 * time.Second)
+	for i := 0; i < 2; i++ {
+		if d, _ := memory.Take(ctx, "k", limit); !d.allowed {
+			t.Fatalf("refilled request %d was refused", i+1)
+		}
+	}
+	if d, _ := memory.Take(ctx, "k", limit); d.allowed {
+		t.Error("more tokens were refilled than the rate allows")
+	}
+
+	// A bucket never holds more than its capacity.
+	memory.buckets["k"].updated = memory.buckets["k"].updated.Add(-time.Hour)
+	if d, _ := memory.Take(ctx, "k", limit); d.tokens != 2 {
+		t.Errorf("tokens after a long pause = %v, want 2", d.tokens)
+	}
+}
+
+func TestRouteRateLimit(t *testing.T) {
+	useMemoryLimiter(t)
+	backend := identityBackend(t)
+	useRoutes(t, routeConfig{
+		Upstreams: map[string]upstreamConfig{"backend": {URL: backend.URL}},
+		RateLimit: rateLimitConfig{Requests: 2, Per: time.Minute},
+		Routes: []routeRule{
+			{Prefix: "/tasks", Upstream: "backend"},
+			{Prefix: "/public", Upstream: "backend", Public: true},
+			{Prefix: "/unlimited", Upstream: "backend", Public: true, RateLimit: &rateLimitConfig{}},
+		},
+	})
+	r := gin.New()
+	r.NoRoute(routeHandler(testAuth))
+
+	request := func(path, token, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	alice, _, _ := testAuth.issueToken(&authUser{ID: 1, Username: "alice", Role: "user"})
+	bob, _, _ := testAuth.issueToken(&authUser{ID: 2, Username: "bob", Role: "user"})
+
+	w := request("/tasks", alice, "192.0.2.1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+		t.Errorf("RateLimit-Limit = %q, want 2", got)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "1" {
+		t.Errorf("RateLimit-Remaining = %q, want 1", got)
+	}
+
+	// Authenticated users are limited per user, whatever their IP.
+	request("/tasks", alice, "192.0.2.2")
+	w = request("/tasks", alice, "192.0.2.3")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request: status = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+	if w := request("/tasks", bob, "192.0.2.1"); w.Code != http.StatusOK {
+		t.Errorf("another user shares the bucket: status = %d", w.Code)
+	}
+
+	// Anonymous requests are limited per IP and per route.
+	request("/public", "", "198.51.100.1")
+	request("/public", "", "198.51.100.1")
+	if w := request("/public", "", "198.51.100.1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("anonymous third request: status = %d, want 429", w.Code)
+	}
+	if w := request("/public", "", "198.51.100.2"); w.Code != http.StatusOK {
+		t.Errorf("another IP shares the bucket: status = %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := request("/unlimited", "", "198.51.100.1"); w.Code != http.StatusOK {
+			t.Fatalf("route without limit: status = %d", w.Code)
+		}
+	}
+}
+
+func TestForgedIdentityDoesNotChooseBucket(t *testing.T) {
+	useMemoryLimiter(t)
+	useRoutes(t, routeConfig{
+		Upstreams: map[string]upstreamConfig{"backend": {URL: identityBackend(t).URL}},
+		RateLimit: rateLimitConfig{Requests: 1, Per: time.Minute},
+		Routes:    []routeRule{{Prefix: "/public", Upstream: "backend", Public: true}},
+	})
+	r := gin.New()
+	r.NoRoute(routeHandler(testAuth))
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/public", nil)
+		req.RemoteAddr = "192.0.2.9:1234"
+		req.Header.Set(headerUserID, strings.Repeat("9", i+1))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	useMemoryLimiter(t)
+	useRoutes(t, routeConfig{
+		Upstreams:      map[string]upstreamConfig{"backend": {URL: "http://127.0.0.1:1"}},
+		LoginRateLimit: rateLimitConfig{Requests: 2, Per: time.Minute},
+		Routes:         []routeRule{{Prefix: "/users", Upstream: "backend"}},
+	})
+	r := gin.New()
+	r.POST("/auth/login", loginRateLimit, loginHandler(testAuth, stubVerifier{
+		user:     authUser{ID: 1, Username: "alice", Role: "user"},
+		password: "secret",
+	}))
+
+	login := func(ip string) int {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login",
+			strings.NewReader(`{"username":"alice","password":"guess"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		if got := login("203.0.113.5"); got != want {
+			t.Errorf("attempt %d: status = %d, want %d", i+1, got, want)
+		}
+	}
+	if got := login("203.0.113.6"); got != http.StatusUnauthorized {
+		t.Errorf("another IP: status = %d, want 401", got)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"shared/metrics"
+)
+
+// defaultRoutes is used when ROUTES_FILE is not set. Upstream URLs may
+// reference environment variables as ${NAME}.
+//
+//go:embed routes.yaml
+var defaultRoutes []byte
+
+// routeConfig is the declarative description of what the gateway proxies.
+// It is read from YAML, so JSON files work as well.
+type routeConfig struct {
+	Upstreams map[string]upstreamConfig `yaml:"upstreams" json:"upstreams"`
+	// RateLimit applies to every route that does not set its own.
+	RateLimit rateLimitConfig `yaml:"rate_limit" json:"rate_limit"`
+	// LoginRateLimit applies to POST /auth/login per client IP.
+	LoginRateLimit rateLimitConfig `yaml:"login_rate_limit" json:"login_rate_limit"`
+	Routes         []routeRule     `yaml:"routes" json:"routes"`
+}
+
+type upstreamConfig struct {
+	URL      string   `yaml:"url" json:"url"`
+	URLs     []string `yaml:"urls" json:"urls"`
+	Strategy string   `yaml:"strategy" json:"strategy"`
+	// Critical upstreams make the gateway unready when all their
+	// instances are down.
+	Critical bool `yaml:"critical" json:"critical"`
+}
+
+type routeRule struct {
+	Prefix   string `yaml:"prefix" json:"prefix"`
+	Upstream string `yaml:"upstream" json:"upstream"`
+	// Public routes are proxied without a bearer token.
+	Public bool `yaml:"public" json:"public"`
+	// Timeout bounds the wait for response headers of one attempt.
+	Timeout time.Duration `yaml:"timeout" json:"timeout"`
+	// Retries is the number of extra attempts for idempotent requests.
+	Retries *int          `yaml:"retries" json:"retries"`
+	Breaker breakerConfig `yaml:"breaker" json:"breaker"`
+	// RateLimit overrides the table-wide limit; requests: 0 disables it.
+	RateLimit *rateLimitConfig `yaml:"rate_limit" json:"rate_limit"`
+}
+
+type breakerConfig struct {
+	// Failures is the number of consecutive failures that opens the circuit.
+	Failures int `yaml:"failures" json:"failures"`
+	// Cooldown is how long the circuit stays open before a trial request.
+	Cooldown time.Duration `yaml:"cooldown" json:"cooldown"`
+}
+
+// Route defaults, applied when the table does not set a value.
+const (
+	defaultRouteTimeout    = 10 * time.Second
+	defaultRouteRetries    = 2
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// routeTable is the compiled form of routeConfig. It is swapped atomically
+// on reload, so requests in flight keep the table they started with.
+type routeTable struct {
+	upstreams map[string]*upstream
+	routes    []compiledRoute
+	// loginLimit is nil when login attempts are not limited.
+	loginLimit *rateLimit
+	stop       context.CancelFunc
+	health     healthCache
+}
+
+type compiledRoute struct {
+	routeRule
+	breaker   *circuitBreaker
+	rateLimit *rateLimit
+	handler   gin.HandlerFunc
+}
+
+var routes atomic.Pointer[routeTable]
+
+// loadRouteTable reads ROUTES_FILE, or the embedded defaults, and compiles it.
+func loadRouteTable() (*routeTable, error) {
+	data, source := defaultRoutes, "embedded routes.yaml"
+	if path := os.Getenv("ROUTES_FILE"); path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+		source = path
+	}
+
+	var cfg routeConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", source, err)
+	}
+
+	table, err := compileRoutes(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	slog.Info("Loaded routes", "routes", len(table.routes), "upstreams", len(table.upstreams), "source", source)
+	return table, nil
+}
+
+func compileRoutes(cfg routeConfig) (*routeTable, error) {
+	if len(cfg.Routes) == 0 {
+		return nil, errors.New("no routes configured")
+	}
+
+	table := &routeTable{upstreams: make(map[string]*upstream)}
+	loginLimit, err := cfg.LoginRateLimit.compile()
+	if err != nil {
+		return nil, fmt.Errorf("login_rate_limit: %w", err)
+	}
+	table.loginLimit = loginLimit
+	for name, upstreamCfg := range cfg.Upstreams {
+		up, err := newUpstream(name, upstreamCfg)
+		if err != nil {
+			return nil, err
+		}
+		table.upstreams[name] = up
+	}
+
+	seen := make(map[string]bool)
+	for _, rule := range cfg.Routes {
+		rule.Prefix = "/" + strings.Trim(rule.Prefix, "/")
+		if seen[rule.Prefix] {
+			return nil, fmt.Errorf("duplicate route %s", rule.Prefix)
+		}
+		seen[rule.Prefix] = true
+
+		up, ok := table.upstreams[rule.Upstream]
+		if !ok {
+			return nil, fmt.Errorf("route %s: unknown upstream %q", rule.Prefix, rule.Upstream)
+		}
+		policy := proxyPolicy{timeout: rule.Timeout, retries: defaultRouteRetries}
+		if policy.timeout <= 0 {
+			policy.timeout = defaultRouteTimeout
+		}
+		if rule.Retries != nil {
+			policy.retries = max(*rule.Retries, 0)
+		}
+		failures, cooldown := rule.Breaker.Failures, rule.Breaker.Cooldown
+		if failures <= 0 {
+			failures = defaultBreakerFailures
+		}
+		if cooldown <= 0 {
+			cooldown = defaultBreakerCooldown
+		}
+		policy.breaker = newCircuitBreaker(failures, cooldown)
+
+		limitCfg := cfg.RateLimit
+		if rule.RateLimit != nil {
+			limitCfg = *rule.RateLimit
+		}
+		limit, err := limitCfg.compile()
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", rule.Prefix, err)
+		}
+
+		table.routes = append(table.routes, compiledRoute{
+			routeRule: rule,
+			breaker:   policy.breaker,
+			rateLimit: limit,
+			handler:   createProxyHandler(up, policy),
+		})
+	}
+
+	// The longest matching prefix wins.
+	sort.Slice(table.routes, func(i, j int) bool {
+		return len(table.routes[i].Prefix) > len(table.routes[j].Prefix)
+	})
+	return table, nil
+}
+
+// start begins active health probing of the table's upstreams.
+func (t *routeTable) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.stop = cancel
+	go t.probeLoop(ctx)
+}
+
+// activateRoutes makes table the current route table.
+func activateRoutes(table *routeTable) {
+	table.start()
+	if previous := routes.Swap(table); previous != nil {
+		previous.stop()
+	}
+}
+
+// match finds the route for path. A prefix matches itself and anything
+// below it, so /users matches /users/1 but not /usersx.
+func (t *routeTable) match(path string) *compiledRoute {
+	for i := range t.routes {
+		prefix := t.routes[i].Prefix
+		if prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return &t.routes[i]
+		}
+	}
+	return nil
+}
+
+// internalPaths are upstream endpoints only the gateway itself calls. They
+// are never proxied: POST /users/verify checks a password and would
+// otherwise bypass login_rate_limit under the /users route limit.
+var internalPaths = map[string]bool{
+	"/users/verify": true,
+}
+
+// routeHandler dispatches every request not handled by the gateway itself
+// through the current route table.
+func routeHandler(cfg authConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := routes.Load().match(c.Request.URL.Path)
+		if route == nil || internalPaths[path.Clean(c.Request.URL.Path)] {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No route for " + c.Request.URL.Path})
+			return
+		}
+		c.Set(metrics.RouteKey, route.Prefix)
+		// Public routes are not authenticated, but must not pass a forged
+		// identity either.
+		stripIdentity(c)
+		if !route.Public && !authenticate(cfg, c) {
+			return
+		}
+		if !checkRateLimit(c, route.Prefix, route.rateLimit) {
+			return
+		}
+		route.handler(c)
+	}
+}
+
+// watchRouteReload reloads the route table on SIGHUP. An invalid file is
+// reported and the previous table stays in place.
+func watchRouteReload() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		table, err := loadRouteTable()
+		if err != nil {
+			slog.Error("Route reload failed, keeping previous routes", "error", err)
+			continue
+		}
+		activateRoutes(table)
+	}
+}
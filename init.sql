@@ -7,7 +7,18 @@ CREATE TABLE IF NOT EXISTS users (
     last_name VARCHAR(50),
     role VARCHAR(20) DEFAULT 'user',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version BIGINT NOT NULL DEFAULT 1
+);
+
+-- Создание таблицы учетных данных (хэши паролей хранятся отдельно от users)
+CREATE TABLE IF NOT EXISTS user_credentials (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    password_changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    failed_attempts INTEGER DEFAULT 0,
+    locked_until TIMESTAMP,
+    must_change BOOLEAN DEFAULT FALSE
 );
 
 -- Создание таблицы проектов
@@ -21,12 +32,22 @@ CREATE TABLE IF NOT EXISTS projects (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Создание таблицы участников проектов
+CREATE TABLE IF NOT EXISTS project_members (
+    project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'member',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, user_id)
+);
+
 -- Создание таблицы задач
 CREATE TABLE IF NOT EXISTS tasks (
     id SERIAL PRIMARY KEY,
     title VARCHAR(200) NOT NULL,
     description TEXT,
     project_id INTEGER REFERENCES projects(id),
+    parent_id INTEGER REFERENCES tasks(id) ON DELETE SET NULL,
     assigned_to INTEGER REFERENCES users(id),
     status VARCHAR(20) DEFAULT 'pending',
     priority VARCHAR(20) DEFAULT 'medium',
@@ -35,7 +56,56 @@ CREATE TABLE IF NOT EXISTS tasks (
     actual_hours DECIMAL(5,2),
     created_by INTEGER REFERENCES users(id),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version BIGINT NOT NULL DEFAULT 1
+);
+
+-- Зависимости между задачами: blocked_by_id блокирует task_id
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    blocked_by_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (task_id, blocked_by_id),
+    CHECK (task_id <> blocked_by_id)
+);
+
+-- История смены статусов задач
+CREATE TABLE IF NOT EXISTS task_status_history (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    from_status VARCHAR(20) NOT NULL DEFAULT '',
+    to_status VARCHAR(20) NOT NULL,
+    changed_by INTEGER REFERENCES users(id),
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Создание таблиц комментариев к задачам
+CREATE TABLE IF NOT EXISTS task_comments (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES task_comments(id),
+    author_id INTEGER REFERENCES users(id),
+    body TEXT NOT NULL,
+    edited_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS task_comment_mentions (
+    comment_id INTEGER NOT NULL REFERENCES task_comments(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    username VARCHAR(50) NOT NULL,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS task_comment_edits (
+    id SERIAL PRIMARY KEY,
+    comment_id INTEGER NOT NULL REFERENCES task_comments(id) ON DELETE CASCADE,
+    body TEXT,
+    edited_by INTEGER REFERENCES users(id),
+    edited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 -- Создание таблицы уведомлений
@@ -51,6 +121,13 @@ CREATE TABLE IF NOT EXISTS notifications (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Обработанные события (идемпотентность автоматических уведомлений)
+CREATE TABLE IF NOT EXISTS processed_events (
+    event_id VARCHAR(100) PRIMARY KEY,
+    event_type VARCHAR(50),
+    processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Создание таблицы активности пользователей
 CREATE TABLE IF NOT EXISTS user_activities (
     id SERIAL PRIMARY KEY,
@@ -68,6 +145,14 @@ CREATE TABLE IF NOT EXISTS user_activities (
 CREATE INDEX IF NOT EXISTS idx_tasks_project_id ON tasks(project_id);
 CREATE INDEX IF NOT EXISTS idx_tasks_assigned_to ON tasks(assigned_to);
 CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
+CREATE INDEX IF NOT EXISTS idx_tasks_parent_id ON tasks(parent_id);
+CREATE INDEX IF NOT EXISTS idx_task_dependencies_blocked_by_id ON task_dependencies(blocked_by_id);
+CREATE INDEX IF NOT EXISTS idx_task_status_history_task_id ON task_status_history(task_id);
+CREATE INDEX IF NOT EXISTS idx_task_comments_task_id ON task_comments(task_id);
+CREATE INDEX IF NOT EXISTS idx_task_comments_parent_id ON task_comments(parent_id);
+CREATE INDEX IF NOT EXISTS idx_task_comments_deleted_at ON task_comments(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_task_comment_edits_comment_id ON task_comment_edits(comment_id);
+CREATE INDEX IF NOT EXISTS idx_project_members_user_id ON project_members(user_id);
 CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id);
 CREATE INDEX IF NOT EXISTS idx_notifications_is_read ON notifications(is_read);
 CREATE INDEX IF NOT EXISTS idx_activities_user_id ON user_activities(user_id);
@@ -80,13 +165,31 @@ INSERT INTO users (username, email, first_name, last_name, role) VALUES
 ('jane_smith', 'jane@company.com', 'Jane', 'Smith', 'user'),
 ('mike_wilson', 'mike@company.com', 'Mike', 'Wilson', 'user');
 
+-- Пароль для всех тестовых пользователей: password123 (bcrypt)
+INSERT INTO user_credentials (user_id, password_hash)
+SELECT id, '$2a$10$Wmz3s0M7tjKTmdbwbK2GOeF1lG5A6V64vG4X0FLqcq2HVIErxAPFS' FROM users;
+
 INSERT INTO projects (name, description, owner_id) VALUES
 ('Website Redesign', 'Complete redesign of company website', 1),
 ('Mobile App Development', 'Development of new mobile application', 2),
 ('Marketing Campaign', 'Q4 marketing campaign preparation', 2);
 
+INSERT INTO project_members (project_id, user_id, role)
+SELECT id, owner_id, 'owner' FROM projects;
+
+INSERT INTO project_members (project_id, user_id, role) VALUES
+(1, 3, 'member'),
+(2, 4, 'member'),
+(3, 3, 'member');
+
 INSERT INTO tasks (title, description, project_id, assigned_to, status, priority, due_date, estimated_hours, created_by) VALUES
 ('Design Homepage', 'Create new homepage design', 1, 3, 'in_progress', 'high', '2024-02-15', 8.0, 1),
 ('Develop API', 'Build REST API for mobile app', 2, 4, 'pending', 'high', '2024-02-20', 16.0, 2),
 ('Write Content', 'Create marketing content for campaign', 3, 3, 'completed', 'medium', '2024-02-10', 4.0, 2),
-('User Testing', 'Conduct user testing for new features', 2, 4, 'pending', 'medium', '2024-02-25', 6.0, 2);
\ No newline at end of file
+('User Testing', 'Conduct user testing for new features', 2, 4, 'pending', 'medium', '2024-02-25', 6.0, 2);
+
+INSERT INTO task_status_history (task_id, to_status, changed_by, changed_at)
+SELECT id, status, created_by, created_at FROM tasks;
+
+-- Тестирование начинается после разработки API
+INSERT INTO task_dependencies (task_id, blocked_by_id, created_by) VALUES (4, 2, 2);
\ No newline at end of file
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The api-gateway verifies the caller's token and forwards the identity in
+// these headers. Clients cannot set them because the gateway strips them.
+const (
+	headerUserID   = "X-User-ID"
+	headerUserRole = "X-User-Role"
+)
+
+// currentUser returns the caller identity propagated by the api-gateway.
+func currentUser(c *gin.Context) (uint, string, bool) {
+	id, err := strconv.ParseUint(c.GetHeader(headerUserID), 10, 64)
+	if err != nil || id == 0 {
+		return 0, "", false
+	}
+	return uint(id), c.GetHeader(headerUserRole), true
+}
+
+// isInternalCall reports whether the request comes from another service
+// rather than through the api-gateway. The gateway authenticates every
+// route it forwards to this service and the backend port is not published,
+// so only internal callers arrive without identity headers.
+func isInternalCall(c *gin.Context) bool {
+	return c.GetHeader(headerUserID) == "" && c.GetHeader(headerUserRole) == ""
+}
+
+// authorizeUser lets the request through when the caller is userID or an
+// admin. It writes the error response itself and returns false otherwise.
+func authorizeUser(c *gin.Context, userID uint) bool {
+	callerID, role, ok := currentUser(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return false
+	}
+	if callerID != userID && role != "admin" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access to another user's data is forbidden"})
+		return false
+	}
+	return true
+}
+
+// authorizeWrite allows creating records for userID by the user themselves,
+// an admin or an internal caller.
+func authorizeWrite(c *gin.Context, userID uint) bool {
+	return isInternalCall(c) || authorizeUser(c, userID)
+}
+
+// parseUserParam reads :user_id and checks that the caller may access it.
+func parseUserParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return 0, false
+	}
+	if !authorizeUser(c, uint(id)) {
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"shared/bootstrap"
+	"shared/events"
+	"shared/logging"
+)
+
+const consumerGroup = "notification-service"
+
+// ProcessedEvent records every event that has produced notifications, so a
+// replayed or redelivered event is skipped.
+type ProcessedEvent struct {
+	EventID     string    `json:"event_id" gorm:"primaryKey"`
+	EventType   string    `json:"event_type"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+var redisClient *redis.Client
+
+func initRedis(app *bootstrap.App) {
+	if app.Config.Redis.Enabled() {
+		redisClient = app.OpenRedis()
+	}
+}
+
+// startConsumers subscribes to the event stream and starts the due-date
+// scanner. Both stop when ctx is cancelled.
+func startConsumers(ctx context.Context) {
+	if err := loadRules(); err != nil {
+		logging.Fatal("Failed to load notification rules", "error", err)
+	}
+
+	if redisClient != nil {
+		name, _ := os.Hostname()
+		consumer := events.NewRedisConsumer(redisClient, os.Getenv("EVENT_STREAM"), consumerGroup, name)
+		go func() {
+			if err := consumer.Run(ctx, handleEvent); err != nil {
+				slog.Error("Event consumer stopped", "error", err)
+			}
+		}()
+	} else {
+		slog.Warn("REDIS_HOST is not set, event-driven notifications are disabled")
+	}
+
+	go runDueSoonScanner(ctx)
+	go hub.run(ctx)
+	context.AfterFunc(ctx, hub.close)
+}
+
+// handleEvent turns an event into notifications according to the rules. The
+// processed marker and the notifications are written in one transaction, so
+// an event is either fully handled or retried.
+func handleEvent(ctx context.Context, event events.Envelope) error {
+	matching := rules[event.Type]
+	if len(matching) == 0 {
+		return nil
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(event.Data, &payload); err != nil {
+		slog.WarnContext(ctx, "Skipping event with invalid payload", "event_type", event.Type, "event_id", event.ID, "error", err)
+		return nil
+	}
+
+	var created []Notification
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		marker := ProcessedEvent{EventID: event.ID, EventType: event.Type, ProcessedAt: time.Now()}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&marker)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		notifications, err := buildNotifications(matching, payload, event.ActorID)
+		if err != nil {
+			return err
+		}
+		for i := range notifications {
+			if err := tx.Create(&notifications[i]).Error; err != nil {
+				return err
+			}
+		}
+		created = notifications
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	publishNotifications(ctx, created...)
+	return nil
+}
+
+// buildNotifications applies the matching rules to an event payload. A
+// user gets at most one notification per event, from the first rule that
+// targets them, so an assignee who is also mentioned is not notified twice.
+func buildNotifications(matching []*NotificationRule, payload map[string]interface{}, actorID uint) ([]Notification, error) {
+	var notifications []Notification
+	notified := make(map[uint]bool)
+	for _, rule := range matching {
+		title, message, err := rule.render(payload)
+		if err != nil {
+			// The same payload fails the same way every time.
+			return nil, events.Permanent(fmt.Errorf("render rule %s: %w", rule.Event, err))
+		}
+		var entityID uint
+		if v, ok := payload[rule.EntityField].(float64); ok {
+			entityID = uint(v)
+		}
+
+		for _, userID := range rule.recipients(payload, actorID) {
+			if notified[userID] {
+				continue
+			}
+			notified[userID] = true
+			notifications = append(notifications, Notification{
+				UserID:            userID,
+				Title:             title,
+				Message:           message,
+				Type:              rule.Type,
+				RelatedEntityType: rule.EntityType,
+				RelatedEntityID:   entityID,
+				CreatedAt:         time.Now(),
+			})
+		}
+	}
+	return notifications, nil
+}
+
+// runDueSoonScanner periodically looks for open tasks whose due date falls
+// within DUE_SOON_WINDOW and emits a synthetic task.due_soon event for each.
+// The event ID includes the due date, so each deadline notifies only once.
+func runDueSoonScanner(ctx context.Context) {
+	interval := bootstrap.EnvDuration("DUE_SOON_CHECK_INTERVAL", 15*time.Minute)
+	window := bootstrap.EnvDuration("DUE_SOON_WINDOW", 24*time.Hour)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		scanDueSoon(ctx, window)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func scanDueSoon(ctx context.Context, window time.Duration) {
+	var tasks []struct {
+		ID         uint
+		Title      string
+		ProjectID  uint
+		AssignedTo uint
+		CreatedBy  uint
+		Status     string
+		Priority   string
+		DueDate    time.Time
+	}
+
+	now := time.Now()
+	err := db.WithContext(ctx).Table("tasks").
+		Select("id, title, project_id, assigned_to, created_by, status, priority, due_date").
+		Where("due_date > ? AND due_date <= ?", now, now.Add(window)).
+		Where("status NOT IN ?", []string{"completed", "cancelled"}).
+		Where("assigned_to IS NOT NULL").
+		Scan(&tasks).Error
+	if err != nil {
+		slog.ErrorContext(ctx, "Due date scan failed", "error", err)
+		return
+	}
+
+	for _, task := range tasks {
+		due := task.DueDate
+		event, err := events.New(events.TaskDueSoon, consumerGroup, 0, events.TaskData{
+			TaskID:     task.ID,
+			Title:      task.Title,
+			ProjectID:  task.ProjectID,
+			AssignedTo: task.AssignedTo,
+			CreatedBy:  task.CreatedBy,
+			Status:     task.Status,
+			Priority:   task.Priority,
+			DueDate:    &due,
+		})
+		if err != nil {
+			continue
+		}
+		event.ID = fmt.Sprintf("due_soon:%d:%d", task.ID, due.Unix())
+		if err := handleEvent(ctx, event); err != nil {
+			slog.ErrorContext(ctx, "Failed to notify due task", "task_id", task.ID, "error", err)
+		}
+	}
+}
@@ -1,16 +1,14 @@
 package main
 
 import (
-	"fmt"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"shared/bootstrap"
+	"shared/logging"
 )
 
 type Notification struct {
@@ -40,13 +38,19 @@ type UserActivity struct {
 var db *gorm.DB
 
 func main() {
-	initDB()
+	app := bootstrap.New("notification-service", "8083")
 
-	r := gin.Default()
+	initDB(app)
+	initRedis(app)
+	startConsumers(app.Context())
+
+	r := app.Router
+	app.RegisterHealth("Notification Service OK", nil)
 
 	// Notification routes
 	r.POST("/notifications", createNotification)
 	r.GET("/notifications/user/:user_id", getUserNotifications)
+	r.GET("/notifications/user/:user_id/stream", streamUserNotifications)
 	r.PUT("/notifications/:id/read", markAsRead)
 	r.DELETE("/notifications/:id", deleteNotification)
 
@@ -55,25 +59,16 @@ func main() {
 	r.GET("/activities/user/:user_id", getUserActivities)
 	r.GET("/activities/stats", getActivityStats)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8083"
-	}
-
-	log.Printf("Notification service running on port %s", port)
-	log.Fatal(r.Run(":" + port))
+	app.Run()
 }
 
-func initDB() {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"), os.Getenv("DB_PORT"))
-
+func initDB(app *bootstrap.App) {
 	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err = app.OpenDB()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
+	db.AutoMigrate(&ProcessedEvent{})
 }
 
 func createNotification(c *gin.Context) {
@@ -82,28 +77,35 @@ func createNotification(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !authorizeWrite(c, notification.UserID) {
+		return
+	}
 
 	notification.CreatedAt = time.Now()
 	notification.IsRead = false
 
-	result := db.Create(&notification)
+	result := db.WithContext(c).Create(&notification)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
 	}
+	publishNotifications(c, notification)
 
 	c.JSON(http.StatusCreated, notification)
 }
 
 func getUserNotifications(c *gin.Context) {
-	userID := c.Param("user_id")
+	userID, ok := parseUserParam(c)
+	if !ok {
+		return
+	}
 	unreadOnly := c.Query("unread_only") == "true"
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	offset := (page - 1) * limit
 
-	query := db.Where("user_id = ?", userID)
+	query := db.WithContext(c).Where("user_id = ?", userID)
 	if unreadOnly {
 		query = query.Where("is_read = ?", false)
 	}
@@ -127,9 +129,12 @@ func getUserNotifications(c *gin.Context) {
 }
 
 func markAsRead(c *gin.Context) {
-	id := c.Param("id")
+	notification, ok := loadOwnNotification(c)
+	if !ok {
+		return
+	}
 
-	result := db.Model(&Notification{}).Where("id = ?", id).Update("is_read", true)
+	result := db.WithContext(c).Model(notification).Update("is_read", true)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
@@ -139,9 +144,12 @@ func markAsRead(c *gin.Context) {
 }
 
 func deleteNotification(c *gin.Context) {
-	id := c.Param("id")
+	notification, ok := loadOwnNotification(c)
+	if !ok {
+		return
+	}
 
-	result := db.Delete(&Notification{}, id)
+	result := db.WithContext(c).Delete(notification)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
@@ -150,18 +158,41 @@ func deleteNotification(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Notification deleted successfully"})
 }
 
+// loadOwnNotification resolves :id to a notification of the caller (or any
+// notification for admins). It writes the error response itself.
+func loadOwnNotification(c *gin.Context) (*Notification, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification id"})
+		return nil, false
+	}
+
+	var notification Notification
+	if err := db.WithContext(c).First(&notification, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return nil, false
+	}
+	if !authorizeUser(c, notification.UserID) {
+		return nil, false
+	}
+	return &notification, true
+}
+
 func logActivity(c *gin.Context) {
 	var activity UserActivity
 	if err := c.ShouldBindJSON(&activity); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !authorizeWrite(c, activity.UserID) {
+		return
+	}
 
 	activity.CreatedAt = time.Now()
 	activity.IPAddress = c.ClientIP()
 	activity.UserAgent = c.GetHeader("User-Agent")
 
-	result := db.Create(&activity)
+	result := db.WithContext(c).Create(&activity)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
@@ -171,7 +202,10 @@ func logActivity(c *gin.Context) {
 }
 
 func getUserActivities(c *gin.Context) {
-	userID := c.Param("user_id")
+	userID, ok := parseUserParam(c)
+	if !ok {
+		return
+	}
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
@@ -180,8 +214,8 @@ func getUserActivities(c *gin.Context) {
 	var activities []UserActivity
 	var total int64
 
-	db.Where("user_id = ?", userID).Model(&UserActivity{}).Count(&total)
-	result := db.Where("user_id = ?", userID).Order("created_at DESC").Offset(offset).Limit(limit).Find(&activities)
+	db.WithContext(c).Where("user_id = ?", userID).Model(&UserActivity{}).Count(&total)
+	result := db.WithContext(c).Where("user_id = ?", userID).Order("created_at DESC").Offset(offset).Limit(limit).Find(&activities)
 
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
@@ -206,15 +240,15 @@ func getActivityStats(c *gin.Context) {
 		ActivitiesByType map[string]int64 `json:"activities_by_type"`
 	}
 
-	db.Model(&UserActivity{}).Where("created_at >= ?", since).Count(&stats.TotalActivities)
-	db.Model(&UserActivity{}).Where("created_at >= ?", since).Distinct("user_id").Count(&stats.UniqueUsers)
+	db.WithContext(c).Model(&UserActivity{}).Where("created_at >= ?", since).Count(&stats.TotalActivities)
+	db.WithContext(c).Model(&UserActivity{}).Where("created_at >= ?", since).Distinct("user_id").Count(&stats.UniqueUsers)
 
 	// Activities by type
 	var typeCounts []struct {
 		ActivityType string
 		Count        int64
 	}
-	db.Model(&UserActivity{}).Where("created_at >= ?", since).
+	db.WithContext(c).Model(&UserActivity{}).Where("created_at >= ?", since).
 		Select("activity_type, count(*) as count").
 		Group("activity_type").Find(&typeCounts)
 
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestNotificationHandlersRejectMalformedIDs(t *testing.T) {
+	r := gin.New()
+	r.PUT("/notifications/:id/read", markAsRead)
+	r.DELETE("/notifications/:id", deleteNotification)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/notifications/1%20OR%201=1/read", nil),
+		httptest.NewRequest(http.MethodDelete, "/notifications/abc", nil),
+	} {
+		req.Header.Set(headerUserID, "1")
+		req.Header.Set(headerUserRole, "user")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: status = %d, want 400", req.Method, req.URL, w.Code)
+		}
+	}
+}
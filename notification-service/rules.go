@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/template"
+)
+
+// NotificationRule describes which notifications an event produces.
+// Recipients name fields of the event payload that hold user IDs (a single
+// ID or a list), e.g. "assigned_to" or "created_by". Title and Message are
+// text/template strings rendered with the payload. Rules for the same event
+// apply in order, and a user gets only the first notification that
+// targets them.
+type NotificationRule struct {
+	Event       string   `json:"event"`
+	Recipients  []string `json:"recipients"`
+	NotifyActor bool     `json:"notify_actor"`
+	Type        string   `json:"type"`
+	Title       string   `json:"title"`
+	Message     string   `json:"message"`
+	EntityType  string   `json:"entity_type"`
+	EntityField string   `json:"entity_field"`
+	Disabled    bool     `json:"disabled"`
+
+	title   *template.Template
+	message *template.Template
+}
+
+var defaultRules = []NotificationRule{
+	{
+		Event:       "task.assigned",
+		Recipients:  []string{"assigned_to"},
+		Type:        "task_assigned",
+		Title:       "New task assigned",
+		Message:     `You have been assigned to "{{.title}}"`,
+		EntityType:  "task",
+		EntityField: "task_id",
+	},
+	{
+		Event:       "task.status_changed",
+		Recipients:  []string{"assigned_to", "created_by"},
+		Type:        "task_status",
+		Title:       "Task status changed",
+		Message:     `"{{.title}}" moved from {{.previous_status}} to {{.status}}`,
+		EntityType:  "task",
+		EntityField: "task_id",
+	},
+	{
+		Event:       "task.due_soon",
+		Recipients:  []string{"assigned_to"},
+		NotifyActor: true,
+		Type:        "task_due",
+		Title:       "Task due soon",
+		Message:     `"{{.title}}" is due {{.due_date}}`,
+		EntityType:  "task",
+		EntityField: "task_id",
+	},
+	{
+		Event:       "task.comment_added",
+		Recipients:  []string{"mentions"},
+		Type:        "task_mention",
+		Title:       "You were mentioned",
+		Message:     `You were mentioned on "{{.title}}": {{.excerpt}}`,
+		EntityType:  "task",
+		EntityField: "task_id",
+	},
+	{
+		Event:       "task.comment_added",
+		Recipients:  []string{"assigned_to", "created_by", "parent_author_id"},
+		Type:        "task_comment",
+		Title:       "New comment",
+		Message:     `New comment on "{{.title}}": {{.excerpt}}`,
+		EntityType:  "task",
+		EntityField: "task_id",
+	},
+	{
+		Event:       "task.comment_mentioned",
+		Recipients:  []string{"mentions"},
+		Type:        "task_mention",
+		Title:       "You were mentioned",
+		Message:     `You were mentioned on "{{.title}}": {{.excerpt}}`,
+		EntityType:  "task",
+		EntityField: "task_id",
+	},
+}
+
+// rules maps an event type to the rules that apply to it.
+var rules map[string][]*NotificationRule
+
+// loadRules reads rules from the JSON file in NOTIFICATION_RULES_FILE, or
+// falls back to defaultRules.
+func loadRules() error {
+	list := defaultRules
+	if path := os.Getenv("NOTIFICATION_RULES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		list = nil
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+
+	loaded := make(map[string][]*NotificationRule)
+	for i := range list {
+		rule := list[i]
+		if rule.Disabled {
+			continue
+		}
+		var err error
+		if rule.title, err = template.New("title").Option("missingkey=zero").Parse(rule.Title); err != nil {
+			return fmt.Errorf("rule %s: title: %w", rule.Event, err)
+		}
+		if rule.message, err = template.New("message").Option("missingkey=zero").Parse(rule.Message); err != nil {
+			return fmt.Errorf("rule %s: message: %w", rule.Event, err)
+		}
+		loaded[rule.Event] = append(loaded[rule.Event], &rule)
+	}
+
+	rules = loaded
+	slog.Info("Loaded notification rules", "rules", len(list))
+	return nil
+}
+
+// recipients resolves the user IDs a rule targets in the payload.
+func (r *NotificationRule) recipients(payload map[string]interface{}, actorID uint) []uint {
+	seen := make(map[uint]bool)
+	var ids []uint
+	add := func(v interface{}) {
+		n, ok := v.(float64)
+		if !ok || n <= 0 {
+			return
+		}
+		id := uint(n)
+		if seen[id] || (id == actorID && !r.NotifyActor) {
+			return
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	for _, field := range r.Recipients {
+		switch v := payload[field].(type) {
+		case []interface{}:
+			for _, item := range v {
+				add(item)
+			}
+		default:
+			add(v)
+		}
+	}
+	return ids
+}
+
+func (r *NotificationRule) render(payload map[string]interface{}) (string, string, error) {
+	var title, message bytes.Buffer
+	if err := r.title.Execute(&title, payload); err != nil {
+		return "", "", err
+	}
+	if err := r.message.Execute(&message, payload); err != nil {
+		return "", "", err
+	}
+	return title.String(), message.String(), nil
+}
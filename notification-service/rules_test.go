@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"shared/events"
+)
+
+// compileRules loads list as if it were the default rules.
+func compileRules(t *testing.T, list []NotificationRule) map[string][]*NotificationRule {
+	t.Helper()
+	previousRules, previousDefaults := rules, defaultRules
+	t.Cleanup(func() { rules, defaultRules = previousRules, previousDefaults })
+	t.Setenv("NOTIFICATION_RULES_FILE", "")
+	defaultRules = list
+	if err := loadRules(); err != nil {
+		t.Fatalf("load rules: %v", err)
+	}
+	return rules
+}
+
+func TestBuildNotificationsOnePerRecipient(t *testing.T) {
+	loaded := compileRules(t, defaultRules)
+
+	// User 2 is the assignee and is mentioned, user 3 created the task and
+	// user 4 is only mentioned. User 5 wrote the comment.
+	data, _ := json.Marshal(events.CommentData{
+		TaskID:     9,
+		Title:      "Release",
+		AssignedTo: 2,
+		CreatedBy:  3,
+		AuthorID:   5,
+		Mentions:   []uint{2, 4, 5},
+		Excerpt:    "@bob @carol please review",
+	})
+	var payload map[string]interface{}
+	json.Unmarshal(data, &payload)
+
+	notifications, err := buildNotifications(loaded["task.comment_added"], payload, 5)
+	if err != nil {
+		t.Fatalf("buildNotifications: %v", err)
+	}
+	got := make(map[uint]string)
+	for _, n := range notifications {
+		if _, ok := got[n.UserID]; ok {
+			t.Errorf("user %d notified twice", n.UserID)
+		}
+		got[n.UserID] = n.Type
+		if n.RelatedEntityID != 9 {
+			t.Errorf("notification for user %d points at task %d, want 9", n.UserID, n.RelatedEntityID)
+		}
+	}
+	want := map[uint]string{2: "task_mention", 3: "task_comment", 4: "task_mention"}
+	if len(got) != len(want) {
+		t.Fatalf("notified %v, want %v", got, want)
+	}
+	for id, typ := range want {
+		if got[id] != typ {
+			t.Errorf("user %d got %q, want %q", id, got[id], typ)
+		}
+	}
+}
+
+func TestBuildNotificationsRenderErrorIsPermanent(t *testing.T) {
+	loaded := compileRules(t, []NotificationRule{{
+		Event:      "task.assigned",
+		Recipients: []string{"assigned_to"},
+		Title:      "{{.title.name}}",
+		Message:    "x",
+	}})
+	payload := map[string]interface{}{"title": "plain string", "assigned_to": float64(2)}
+	if _, err := buildNotifications(loaded["task.assigned"], payload, 1); !events.IsPermanent(err) {
+		t.Errorf("err = %v, want a permanent error", err)
+	}
+}
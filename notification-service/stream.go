@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"shared/bootstrap"
+)
+
+// New notifications are published on a per-user Redis channel. Every replica
+// subscribes to the whole pattern and forwards messages to the SSE clients
+// connected to it, so a client receives notifications no matter which
+// replica created them.
+const (
+	notificationChannelPrefix  = "notifications:user:"
+	notificationChannelPattern = notificationChannelPrefix + "*"
+	streamReplayLimit          = 100
+)
+
+// streamHub fans notifications out to the SSE connections of this replica.
+type streamHub struct {
+	mu      sync.Mutex
+	clients map[uint]map[chan Notification]struct{}
+	// closed ends every stream when the service shuts down, so open
+	// connections do not hold up the graceful shutdown.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var hub = &streamHub{
+	clients: make(map[uint]map[chan Notification]struct{}),
+	closed:  make(chan struct{}),
+}
+
+func (h *streamHub) subscribe(userID uint) chan Notification {
+	ch := make(chan Notification, 16)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[chan Notification]struct{})
+	}
+	h.clients[userID][ch] = struct{}{}
+	return ch
+}
+
+func (h *streamHub) unsubscribe(userID uint, ch chan Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients[userID], ch)
+	if len(h.clients[userID]) == 0 {
+		delete(h.clients, userID)
+	}
+}
+
+func (h *streamHub) close() {
+	h.closeOnce.Do(func() { close(h.closed) })
+}
+
+func (h *streamHub) dispatch(notification Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients[notification.UserID] {
+		select {
+		case ch <- notification:
+		default:
+			// The client is not keeping up; it will catch up from the
+			// database with Last-Event-ID when it reconnects.
+		}
+	}
+}
+
+// run relays notifications published by any replica to local clients.
+func (h *streamHub) run(ctx context.Context) {
+	if redisClient == nil {
+		return
+	}
+	pubsub := redisClient.PSubscribe(ctx, notificationChannelPattern)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var notification Notification
+			if err := json.Unmarshal([]byte(msg.Payload), &notification); err != nil {
+				slog.WarnContext(ctx, "Dropping malformed notification", "channel", msg.Channel, "error", err)
+				continue
+			}
+			h.dispatch(notification)
+		}
+	}
+}
+
+// publishNotifications announces freshly stored notifications to stream
+// subscribers. Without Redis they are only delivered on this replica.
+func publishNotifications(ctx context.Context, notifications ...Notification) {
+	for _, notification := range notifications {
+		if redisClient == nil {
+			hub.dispatch(notification)
+			continue
+		}
+		payload, err := json.Marshal(notification)
+		if err != nil {
+			continue
+		}
+		channel := notificationChannelPrefix + strconv.FormatUint(uint64(notification.UserID), 10)
+		if err := redisClient.Publish(ctx, channel, payload).Err(); err != nil {
+			slog.ErrorContext(ctx, "Failed to publish notification", "notification_id", notification.ID, "error", err)
+		}
+	}
+}
+
+// sendReset tells a client that missed more than streamReplayLimit
+// notifications to reload them with GET /notifications/user/:user_id
+// instead of replaying them. The event id moves the client past the
+// notifications it has to reload.
+func sendReset(c *gin.Context, userID uint) {
+	var latest uint64
+	db.WithContext(c).Model(&Notification{}).Where("user_id = ?", userID).
+		Select("COALESCE(MAX(id), 0)").Scan(&latest)
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatUint(latest, 10),
+		Event: "reset",
+		Data:  gin.H{"reason": "too_many_missed", "replay_limit": streamReplayLimit},
+	})
+	c.Writer.Flush()
+}
+
+// streamUserNotifications serves GET /notifications/user/:user_id/stream as
+// Server-Sent Events. Each event id is the notification id, so a client that
+// reconnects with Last-Event-ID first receives what it missed.
+func streamUserNotifications(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+	userID := uint(id)
+
+	if !authorizeUser(c, userID) {
+		return
+	}
+
+	var lastID uint64
+	if raw := c.GetHeader("Last-Event-ID"); raw != "" {
+		lastID, _ = strconv.ParseUint(strings.TrimSpace(raw), 10, 64)
+	} else if raw := c.Query("last_event_id"); raw != "" {
+		lastID, _ = strconv.ParseUint(raw, 10, 64)
+	}
+
+	// Subscribe before replaying so nothing created in between is lost;
+	// what was both replayed and published is sent once.
+	ch := hub.subscribe(userID)
+	defer hub.unsubscribe(userID, ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// Ids are not published in order: concurrent transactions commit in any
+	// order, so a notification may arrive after one with a higher id.
+	// Published notifications are therefore never filtered by id, only
+	// against the replayed ones.
+	replayed := make(map[uint]bool)
+	send := func(notification Notification) {
+		c.Render(-1, sse.Event{
+			Id:    strconv.FormatUint(uint64(notification.ID), 10),
+			Event: "notification",
+			Data:  notification,
+		})
+		c.Writer.Flush()
+	}
+
+	// Tell the client how long to wait before reconnecting.
+	c.Writer.WriteString("retry: 3000\n\n")
+	c.Writer.Flush()
+
+	if lastID > 0 {
+		var missed []Notification
+		db.WithContext(c).Where("user_id = ? AND id > ?", userID, lastID).
+			Order("id").Limit(streamReplayLimit + 1).Find(&missed)
+		if len(missed) > streamReplayLimit {
+			sendReset(c, userID)
+		} else {
+			for _, notification := range missed {
+				replayed[notification.ID] = true
+				send(notification)
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(bootstrap.EnvDuration("SSE_HEARTBEAT_INTERVAL", 15*time.Second))
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hub.closed:
+			return
+		case notification := <-ch:
+			if !replayed[notification.ID] {
+				send(notification)
+			}
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
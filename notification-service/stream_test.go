@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// openStream connects to the notification stream of userID and returns its
+// lines once the stream is subscribed.
+func openStream(t *testing.T, userID string) <-chan string {
+	t.Helper()
+	r := gin.New()
+	r.GET("/notifications/user/:user_id/stream", streamUserNotifications)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/notifications/user/"+userID+"/stream", nil)
+	req.Header.Set(headerUserID, userID)
+	req.Header.Set(headerUserRole, "user")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	// The retry hint is written after the client has subscribed.
+	for line := range lines {
+		if strings.HasPrefix(line, "retry:") {
+			return lines
+		}
+	}
+	t.Fatal("stream closed before it was ready")
+	return nil
+}
+
+func nextEventID(t *testing.T, lines <-chan string) string {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed")
+			}
+			if id, found := strings.CutPrefix(line, "id:"); found {
+				return id
+			}
+		case <-timeout:
+			t.Fatal("no event within 2s")
+		}
+	}
+}
+
+func TestStreamDeliversOutOfOrderIDs(t *testing.T) {
+	lines := openStream(t, "5")
+
+	// A transaction that took the lower id may commit after a later one.
+	publishNotifications(context.Background(),
+		Notification{ID: 11, UserID: 5, Title: "second"},
+		Notification{ID: 10, UserID: 5, Title: "first"},
+	)
+	for _, want := range []string{"11", "10"} {
+		if got := nextEventID(t, lines); got != want {
+			t.Errorf("event id = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestHubRunStopsWithContext(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	previous := redisClient
+	redisClient = client
+	t.Cleanup(func() {
+		client.Close()
+		redisClient = previous
+	})
+
+	h := &streamHub{clients: make(map[uint]map[chan Notification]struct{}), closed: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.run(ctx)
+		close(done)
+	}()
+
+	ch := h.subscribe(3)
+	deadline := time.Now().Add(2 * time.Second)
+	for delivered := false; !delivered; {
+		if time.Now().After(deadline) {
+			t.Fatal("relay did not deliver a published notification")
+		}
+		publishNotifications(context.Background(), Notification{ID: 1, UserID: 3})
+		select {
+		case <-ch:
+			delivered = true
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,121 @@
+// Package bootstrap holds the start-up and shutdown code shared by the
+// services: configuration, database and Redis connections, the gin router
+// with the common middleware, health endpoints and graceful shutdown.
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"shared/logging"
+	"shared/metrics"
+	"shared/telemetry"
+)
+
+// App is a service being started.
+type App struct {
+	Config Config
+	// Router already carries tracing, logging, recovery and metrics
+	// middleware and serves /metrics.
+	Router *gin.Engine
+
+	ctx     context.Context
+	stop    context.CancelFunc
+	closers []func(context.Context) error
+
+	// set by OpenDB and OpenRedis, checked by the health endpoints
+	db    pinger
+	redis pinger
+}
+
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// New sets up logging and tracing for service and builds its router. The
+// service listens on PORT, or defaultPort when it is not set.
+func New(service, defaultPort string) *App {
+	logging.Init(service)
+
+	app := &App{Config: LoadConfig(service, defaultPort)}
+	app.ctx, app.stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	shutdownTracing, err := telemetry.Init(app.ctx, service)
+	if err != nil {
+		logging.Fatal("Failed to initialize tracing", "error", err)
+	}
+	app.OnShutdown(shutdownTracing)
+
+	r := gin.New()
+	// Handlers pass c to GORM, Redis and slog, so c must expose the request
+	// context that carries the trace and the request ID.
+	r.ContextWithFallback = true
+	// c.ClientIP keys rate limits and load balancing, so X-Forwarded-For is
+	// only honoured from the configured proxies.
+	if err := r.SetTrustedProxies(app.Config.TrustedProxies); err != nil {
+		logging.Fatal("Invalid TRUSTED_PROXIES", "error", err)
+	}
+	r.Use(telemetry.Middleware(service))
+	r.Use(logging.Middleware(), logging.Recovery())
+	r.Use(metrics.Middleware())
+	r.GET("/metrics", metrics.Handler())
+	app.Router = r
+
+	return app
+}
+
+// Context is cancelled when the service starts shutting down. Background
+// workers should stop when it is done.
+func (a *App) Context() context.Context {
+	return a.ctx
+}
+
+// OnShutdown registers fn to run after the HTTP server has stopped.
+// Functions run in reverse order of registration.
+func (a *App) OnShutdown(fn func(context.Context) error) {
+	a.closers = append(a.closers, fn)
+}
+
+// Run serves the router until SIGINT or SIGTERM, then stops accepting
+// connections, waits up to ShutdownTimeout for in-flight requests and
+// releases the resources registered with OnShutdown.
+func (a *App) Run() {
+	srv := &http.Server{
+		Addr:              ":" + a.Config.Port,
+		Handler:           a.Router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	slog.Info("Service running", "port", a.Config.Port)
+
+	select {
+	case err := <-errs:
+		logging.Fatal("Server stopped", "error", err)
+	case <-a.ctx.Done():
+	}
+	a.stop()
+	slog.Info("Shutting down", "timeout", a.Config.ShutdownTimeout.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Failed to finish in-flight requests", "error", err)
+	}
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		if err := a.closers[i](ctx); err != nil {
+			slog.Error("Failed to release resource", "error", err)
+		}
+	}
+	slog.Info("Service stopped")
+}
@@ -0,0 +1,149 @@
+package bootstrap
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings every service reads from the environment.
+type Config struct {
+	Service string
+	// Port is taken from PORT.
+	Port string
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	// after SIGINT or SIGTERM (SHUTDOWN_TIMEOUT).
+	ShutdownTimeout time.Duration
+	// TrustedProxies lists the proxies (IPs or CIDRs) whose
+	// X-Forwarded-For is believed when resolving the client IP
+	// (TRUSTED_PROXIES, comma-separated). Empty trusts no proxy.
+	TrustedProxies []string
+	DB             DBConfig
+	Redis          RedisConfig
+}
+
+// DBConfig describes the PostgreSQL connection and its pool.
+type DBConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectAttempts is how many times the first connection is tried;
+	// the wait between attempts starts at ConnectBackoff and doubles.
+	ConnectAttempts int
+	ConnectBackoff  time.Duration
+}
+
+// DSN returns the connection string for the PostgreSQL driver.
+func (c DBConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+		c.Host, c.User, c.Password, c.Name, c.Port, c.SSLMode)
+}
+
+// RedisConfig describes the Redis connection.
+type RedisConfig struct {
+	Host     string
+	Port     string
+	Password string
+	DB       int
+}
+
+// Enabled reports whether Redis is configured at all.
+func (c RedisConfig) Enabled() bool {
+	return c.Host != ""
+}
+
+func (c RedisConfig) Addr() string {
+	return c.Host + ":" + c.Port
+}
+
+// LoadConfig reads the configuration of service from the environment.
+func LoadConfig(service, defaultPort string) Config {
+	return Config{
+		Service:         service,
+		Port:            EnvString("PORT", defaultPort),
+		ShutdownTimeout: EnvDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		TrustedProxies:  EnvList("TRUSTED_PROXIES"),
+		DB: DBConfig{
+			Host:            os.Getenv("DB_HOST"),
+			Port:            EnvString("DB_PORT", "5432"),
+			User:            os.Getenv("DB_USER"),
+			Password:        os.Getenv("DB_PASSWORD"),
+			Name:            os.Getenv("DB_NAME"),
+			SSLMode:         EnvString("DB_SSLMODE", "disable"),
+			MaxOpenConns:    EnvInt("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:    EnvInt("DB_MAX_IDLE_CONNS", 10),
+			ConnMaxLifetime: EnvDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+			ConnMaxIdleTime: EnvDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+			ConnectAttempts: EnvInt("DB_CONNECT_ATTEMPTS", 10),
+			ConnectBackoff:  EnvDuration("DB_CONNECT_BACKOFF", time.Second),
+		},
+		Redis: RedisConfig{
+			Host:     os.Getenv("REDIS_HOST"),
+			Port:     EnvString("REDIS_PORT", "6379"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+			DB:       EnvInt("REDIS_DB", 0),
+		},
+	}
+}
+
+// EnvString returns the variable name, or fallback when it is unset.
+func EnvString(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// EnvList splits a comma-separated variable; it returns nil when unset.
+func EnvList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// EnvInt parses the variable name as a non-negative integer. It returns
+// fallback, with a warning for invalid values, when that fails.
+func EnvInt(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		slog.Warn("Invalid integer, using default", "variable", name, "value", raw, "default", fallback)
+		return fallback
+	}
+	return n
+}
+
+// EnvDuration parses the variable name as a positive duration such as
+// "30s". It returns fallback, with a warning for invalid values, when that
+// fails.
+func EnvDuration(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration, using default", "variable", name, "value", raw, "default", fallback.String())
+		return fallback
+	}
+	return d
+}
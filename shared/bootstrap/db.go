@@ -0,0 +1,84 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"shared/logging"
+	"shared/metrics"
+	"shared/telemetry"
+)
+
+// maxConnectBackoff caps the wait between connection attempts.
+const maxConnectBackoff = 30 * time.Second
+
+// OpenDB connects to PostgreSQL, retrying with exponential backoff while the
+// database is starting up, and tunes the connection pool. The connection is
+// traced, exported as metrics, checked by the health endpoints and closed
+// on shutdown.
+func (a *App) OpenDB() (*gorm.DB, error) {
+	cfg := a.Config.DB
+
+	var (
+		db  *gorm.DB
+		err error
+	)
+	wait := cfg.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		// Failed attempts are reported below, not by GORM.
+		db, err = gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{Logger: gormlogger.Discard})
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.ConnectAttempts {
+			return nil, fmt.Errorf("after %d attempts: %w", attempt, err)
+		}
+		slog.Warn("Database is not available, retrying",
+			"attempt", attempt, "retry_in", wait.String(), "error", err)
+		select {
+		case <-a.ctx.Done():
+			return nil, a.ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, maxConnectBackoff)
+	}
+	slog.Info("Successfully connected to database", "host", cfg.Host, "database", cfg.Name)
+	db.Logger = logging.GormLogger()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := telemetry.InstrumentDB(db); err != nil {
+		slog.Warn("Failed to instrument database", "error", err)
+	}
+	if err := metrics.RegisterDB(db, cfg.Name); err != nil {
+		slog.Warn("Failed to register database metrics", "error", err)
+	}
+
+	a.db = sqlPinger{db}
+	a.OnShutdown(func(context.Context) error { return sqlDB.Close() })
+	return db, nil
+}
+
+type sqlPinger struct {
+	db *gorm.DB
+}
+
+func (p sqlPinger) Ping(ctx context.Context) error {
+	sqlDB, err := p.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
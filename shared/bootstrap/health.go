@@ -0,0 +1,64 @@
+package bootstrap
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// RegisterHealth adds the health endpoints:
+//   - GET /health reports status, the database and Redis state and the
+//     fields returned by extra (which may be nil); it always answers 200 so
+//     the response can be read while a dependency is down;
+//   - GET /livez answers 200 while the process serves requests;
+//   - GET /readyz answers 503 while the database or Redis is unreachable.
+func (a *App) RegisterHealth(status string, extra func(c *gin.Context) gin.H) {
+	a.Router.GET("/health", func(c *gin.Context) {
+		response := gin.H{
+			"status":    status,
+			"database":  checkStatus(c, a.db),
+			"redis":     checkStatus(c, a.redis),
+			"timestamp": time.Now().Format(time.RFC3339),
+		}
+		if extra != nil {
+			for key, value := range extra(c) {
+				response[key] = value
+			}
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	a.Router.GET("/livez", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "OK"})
+	})
+
+	a.Router.GET("/readyz", func(c *gin.Context) {
+		database, redis := checkStatus(c, a.db), checkStatus(c, a.redis)
+		if database == "ERROR" || redis == "ERROR" {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":   "NOT_READY",
+				"database": database,
+				"redis":    redis,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "READY"})
+	})
+}
+
+// checkStatus returns OK, ERROR, or DISABLED when the dependency is not used.
+func checkStatus(ctx context.Context, p pinger) string {
+	if p == nil {
+		return "DISABLED"
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if err := p.Ping(ctx); err != nil {
+		return "ERROR"
+	}
+	return "OK"
+}
@@ -0,0 +1,40 @@
+package bootstrap
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+	"shared/telemetry"
+)
+
+// OpenRedis returns a traced Redis client for the configured server. It
+// does not fail when the server is down: callers are expected to degrade
+// gracefully, so an unreachable server is only reported. Services that can
+// run without Redis should check Config.Redis.Enabled first.
+func (a *App) OpenRedis() *redis.Client {
+	cfg := a.Config.Redis
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr(),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := telemetry.InstrumentRedis(client); err != nil {
+		slog.Warn("Failed to instrument Redis", "error", err)
+	}
+	if err := client.Ping(a.ctx).Err(); err != nil {
+		slog.Warn("Redis is not available", "addr", cfg.Addr(), "error", err)
+	}
+
+	a.redis = redisPinger{client}
+	a.OnShutdown(func(context.Context) error { return client.Close() })
+	return client
+}
+
+type redisPinger struct {
+	client *redis.Client
+}
+
+func (p redisPinger) Ping(ctx context.Context) error {
+	return p.client.Ping(ctx).Err()
+}
@@ -0,0 +1,112 @@
+// Package conditional implements ETags derived from a resource version and
+// the conditional request headers If-Match and If-None-Match (RFC 9110).
+package conditional
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrPreconditionFailed means If-Match does not name the current version.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrPreconditionRequired means If-Match is missing in strict mode.
+	ErrPreconditionRequired = errors.New("precondition required")
+)
+
+// Strict makes If-Match mandatory on writes. It is enabled with
+// REQUIRE_IF_MATCH=true.
+var Strict, _ = strconv.ParseBool(os.Getenv("REQUIRE_IF_MATCH"))
+
+// ETag returns the strong entity tag of a resource version.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// DerivedETag returns the entity tag of a representation that adds read-only
+// data derived from other resources to version, such as a task with the
+// totals of its subtasks. The tag changes with either part, while If-Match
+// compares only the version, since writes cannot change the derived data.
+func DerivedETag(version int64, derived string) string {
+	if derived == "" {
+		return ETag(version)
+	}
+	return `"` + strconv.FormatInt(version, 10) + "-" + derived + `"`
+}
+
+// SetETag sets the ETag response header.
+func SetETag(c *gin.Context, version int64) {
+	c.Header("ETag", ETag(version))
+}
+
+// NotModified answers a read with 304 Not Modified when If-None-Match names
+// the current version and reports whether it did. Otherwise it only sets
+// the ETag header.
+func NotModified(c *gin.Context, version int64) bool {
+	return NotModifiedETag(c, ETag(version))
+}
+
+// NotModifiedETag is NotModified for a tag made by DerivedETag.
+func NotModifiedETag(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if header := c.GetHeader("If-None-Match"); header != "" && matches(header, etag, true) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// CheckIfMatch compares If-Match with the current version of the resource
+// a write is about to change. A missing header passes unless Strict is set.
+func CheckIfMatch(c *gin.Context, version int64) error {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if Strict {
+			return ErrPreconditionRequired
+		}
+		return nil
+	}
+	if !matches(header, ETag(version), false) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// versionTag strips the derived part from a tag made by DerivedETag.
+func versionTag(etag string) string {
+	if version, _, found := strings.Cut(etag, "-"); found {
+		return version + `"`
+	}
+	return etag
+}
+
+// matches reports whether the list of entity tags in header contains etag.
+// If-Match uses the strong comparison, so weak tags only match when weak
+// is set, as for If-None-Match. If-Match names a version, so the derived
+// part of a listed tag is ignored.
+func matches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if !weak {
+			candidate = versionTag(candidate)
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
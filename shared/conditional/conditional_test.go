@@ -0,0 +1,144 @@
+package conditional
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		etag   string
+		weak   bool
+		want   bool
+	}{
+		{"same tag", `"3"`, `"3"`, false, true},
+		{"other tag", `"4"`, `"3"`, false, false},
+		{"list", `"1", "3"`, `"3"`, false, true},
+		{"list without spaces", `"1","3"`, `"3"`, false, true},
+		{"wildcard", `*`, `"3"`, false, true},
+		{"wildcard weak", `*`, `"3"`, true, true},
+		{"weak tag strong comparison", `W/"3"`, `"3"`, false, false},
+		{"weak tag weak comparison", `W/"3"`, `"3"`, true, true},
+		{"unquoted", `3`, `"3"`, false, false},
+		{"derived tag strong comparison", `"3-abc"`, `"3"`, false, true},
+		{"derived tag other version", `"4-abc"`, `"3"`, false, false},
+		{"derived tag weak comparison", `"3-abc"`, `"3"`, true, false},
+		{"derived tag exact", `"3-abc"`, `"3-abc"`, true, true},
+		{"derived tag changed", `"3-abc"`, `"3-def"`, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matches(tt.header, tt.etag, tt.weak); got != tt.want {
+				t.Errorf("matches(%s, %s, weak=%v) = %v, want %v", tt.header, tt.etag, tt.weak, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDerivedETag(t *testing.T) {
+	if got := DerivedETag(3, ""); got != `"3"` {
+		t.Errorf("DerivedETag(3, \"\") = %s, want \"3\"", got)
+	}
+	if got := DerivedETag(3, "abc"); got != `"3-abc"` {
+		t.Errorf("DerivedETag(3, abc) = %s, want \"3-abc\"", got)
+	}
+}
+
+func newContext(header, value string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		c.Request.Header.Set(header, value)
+	}
+	return c, w
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		strict  bool
+		want    error
+	}{
+		{"missing", "", false, nil},
+		{"missing strict", "", true, ErrPreconditionRequired},
+		{"current", `"5"`, false, nil},
+		{"current strict", `"5"`, true, nil},
+		{"stale", `"4"`, false, ErrPreconditionFailed},
+		{"stale in list", `"3", "4"`, false, ErrPreconditionFailed},
+		{"current in list", `"4", "5"`, false, nil},
+		{"wildcard", `*`, true, nil},
+		{"weak", `W/"5"`, false, ErrPreconditionFailed},
+		{"derived", `"5-abc"`, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := Strict
+			Strict = tt.strict
+			defer func() { Strict = previous }()
+
+			header := ""
+			if tt.ifMatch != "" {
+				header = "If-Match"
+			}
+			c, _ := newContext(header, tt.ifMatch)
+			if err := CheckIfMatch(c, 5); !errors.Is(err, tt.want) {
+				t.Errorf("CheckIfMatch(%s) = %v, want %v", tt.ifMatch, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"missing", "", false},
+		{"current", `"5"`, true},
+		{"weak current", `W/"5"`, true},
+		{"stale", `"4"`, false},
+		{"wildcard", `*`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := ""
+			if tt.ifNoneMatch != "" {
+				header = "If-None-Match"
+			}
+			c, w := newContext(header, tt.ifNoneMatch)
+			if got := NotModified(c, 5); got != tt.want {
+				t.Errorf("NotModified = %v, want %v", got, tt.want)
+			}
+			if etag := w.Header().Get("ETag"); etag != `"5"` {
+				t.Errorf("ETag = %s, want \"5\"", etag)
+			}
+			if tt.want && c.Writer.Status() != http.StatusNotModified {
+				t.Errorf("status = %d, want 304", c.Writer.Status())
+			}
+		})
+	}
+}
+
+func TestNotModifiedETagChangesWithDerivedData(t *testing.T) {
+	c, _ := newContext("If-None-Match", `"5-abc"`)
+	if NotModifiedETag(c, DerivedETag(5, "def")) {
+		t.Error("a changed rollup answered 304")
+	}
+	c, _ = newContext("If-None-Match", `"5-abc"`)
+	if !NotModifiedETag(c, DerivedETag(5, "abc")) {
+		t.Error("an unchanged rollup did not answer 304")
+	}
+}
@@ -0,0 +1,42 @@
+package events
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FromEnv selects a publisher from EVENT_BUS: "redis" (the default when a
+// Redis client is available), "memory" or "none". EVENT_STREAM and
+// EVENT_STREAM_MAXLEN configure the Redis stream.
+func FromEnv(client redis.UniversalClient) Publisher {
+	backend := os.Getenv("EVENT_BUS")
+	if backend == "" {
+		backend = "redis"
+		if client == nil {
+			backend = "none"
+		}
+	}
+
+	switch backend {
+	case "redis":
+		if client == nil {
+			slog.Warn("EVENT_BUS=redis but Redis is not configured, events are disabled")
+			return Nop{}
+		}
+		maxLen, _ := strconv.ParseInt(os.Getenv("EVENT_STREAM_MAXLEN"), 10, 64)
+		if maxLen == 0 {
+			maxLen = 100000
+		}
+		return NewRedisStream(client, os.Getenv("EVENT_STREAM"), maxLen)
+	case "memory":
+		return NewMemory()
+	case "none":
+		return Nop{}
+	default:
+		slog.Warn("Unknown EVENT_BUS, events are disabled", "value", backend)
+		return Nop{}
+	}
+}
@@ -0,0 +1,233 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Handler processes one event. Returning an error leaves the event
+// unacknowledged so it is delivered again later; handlers must therefore be
+// idempotent. Errors wrapped with Permanent are not retried, and an event
+// that keeps failing is given up after DefaultMaxDeliveries deliveries.
+type Handler func(ctx context.Context, event Envelope) error
+
+// DeadLetterSuffix is appended to the stream name to get the stream that
+// keeps events failed with a permanent error or too many times.
+const DeadLetterSuffix = ":dead"
+
+// DefaultMaxDeliveries is how often a RedisConsumer delivers an event whose
+// handler keeps failing before it moves the event to the dead-letter stream.
+const DefaultMaxDeliveries = 5
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that redelivering the event cannot fix, such
+// as a template that fails to render. The event is acknowledged and moved
+// to the dead-letter stream instead of being delivered again.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Subscriber delivers events to a handler until ctx is cancelled.
+type Subscriber interface {
+	Run(ctx context.Context, handle Handler) error
+}
+
+// RedisConsumer reads a Redis stream as a member of a consumer group, so
+// several replicas of a service share the work and every event is handled
+// by one of them.
+type RedisConsumer struct {
+	client        redis.UniversalClient
+	stream        string
+	group         string
+	name          string
+	batch         int64
+	block         time.Duration
+	minIdle       time.Duration
+	maxDeliveries int64
+}
+
+// NewRedisConsumer creates a consumer named name in group. Entries left
+// pending by a crashed consumer are claimed after they have been idle for
+// a minute.
+func NewRedisConsumer(client redis.UniversalClient, stream, group, name string) *RedisConsumer {
+	if stream == "" {
+		stream = DefaultStream
+	}
+	return &RedisConsumer{
+		client:        client,
+		stream:        stream,
+		group:         group,
+		name:          name,
+		batch:         50,
+		block:         5 * time.Second,
+		minIdle:       time.Minute,
+		maxDeliveries: DefaultMaxDeliveries,
+	}
+}
+
+func (c *RedisConsumer) Run(ctx context.Context, handle Handler) error {
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	// Entries delivered to this consumer before a restart come first.
+	c.read(ctx, "0", handle)
+
+	lastReclaim := time.Now()
+	for ctx.Err() == nil {
+		if time.Since(lastReclaim) >= c.minIdle {
+			c.reclaim(ctx, handle)
+			lastReclaim = time.Now()
+		}
+		c.read(ctx, ">", handle)
+	}
+	return nil
+}
+
+func (c *RedisConsumer) read(ctx context.Context, start string, handle Handler) {
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.name,
+		Streams:  []string{c.stream, start},
+		Count:    c.batch,
+		Block:    c.block,
+	}).Result()
+	if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read stream", "stream", c.stream, "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+		return
+	}
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			c.process(ctx, msg, handle)
+		}
+	}
+}
+
+// reclaim takes over entries another consumer received but never
+// acknowledged, typically because it crashed.
+func (c *RedisConsumer) reclaim(ctx context.Context, handle Handler) {
+	messages, _, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.name,
+		MinIdle:  c.minIdle,
+		Start:    "0-0",
+		Count:    c.batch,
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Failed to claim pending entries", "stream", c.stream, "error", err)
+		}
+		return
+	}
+	for _, msg := range messages {
+		c.process(ctx, msg, handle)
+	}
+}
+
+func (c *RedisConsumer) process(ctx context.Context, msg redis.XMessage, handle Handler) {
+	raw, _ := msg.Values["envelope"].(string)
+
+	var event Envelope
+	if err := json.Unmarshal([]byte(raw), &event); err != nil {
+		// A malformed entry will never succeed; acknowledge it so it does
+		// not block the group forever.
+		slog.WarnContext(ctx, "Dropping malformed event", "message_id", msg.ID, "error", err)
+		c.client.XAck(ctx, c.stream, c.group, msg.ID)
+		return
+	}
+
+	if err := handle(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to handle event", "event_type", event.Type, "event_id", event.ID, "error", err)
+		if !IsPermanent(err) && !c.exhausted(ctx, msg.ID) {
+			return
+		}
+		if !c.deadLetter(ctx, msg, raw, err) {
+			return
+		}
+	}
+	if err := c.client.XAck(ctx, c.stream, c.group, msg.ID).Err(); err != nil {
+		slog.ErrorContext(ctx, "Failed to acknowledge event", "event_id", event.ID, "error", err)
+	}
+}
+
+// exhausted reports whether the entry has been delivered maxDeliveries
+// times. The count is the delivery counter Redis keeps for pending entries;
+// if it cannot be read the entry is retried.
+func (c *RedisConsumer) exhausted(ctx context.Context, id string) bool {
+	entries, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(entries) == 0 {
+		return false
+	}
+	return entries[0].RetryCount >= c.maxDeliveries
+}
+
+// deadLetter copies a failed entry to the dead-letter stream with the error
+// that stopped it. It reports whether the copy was written, which is when
+// the entry may be acknowledged.
+func (c *RedisConsumer) deadLetter(ctx context.Context, msg redis.XMessage, raw string, cause error) bool {
+	err := c.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: c.stream + DeadLetterSuffix,
+		Values: map[string]interface{}{
+			"envelope":   raw,
+			"error":      cause.Error(),
+			"group":      c.group,
+			"message_id": msg.ID,
+		},
+	}).Err()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to dead-letter event", "message_id", msg.ID, "error", err)
+		return false
+	}
+	return true
+}
+
+// Run delivers events published to the in-memory bus from now on.
+func (m *Memory) Run(ctx context.Context, handle Handler) error {
+	ch := m.Subscribe(100)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := handle(ctx, event); err != nil {
+				slog.ErrorContext(ctx, "Failed to handle event", "event_type", event.Type, "event_id", event.ID, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package events defines the domain event envelope shared by the services
+// and the publishers that deliver it.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// EnvelopeVersion is the version of the envelope format itself. The schema
+// of Data is versioned per event type through Envelope.DataVersion.
+const EnvelopeVersion = 1
+
+// Event types published by the services.
+const (
+	TaskCreated          = "task.created"
+	TaskUpdated          = "task.updated"
+	TaskAssigned         = "task.assigned"
+	TaskStatusChanged    = "task.status_changed"
+	TaskDeleted          = "task.deleted"
+	TaskDueSoon          = "task.due_soon"
+	TaskCommentAdded     = "task.comment_added"
+	TaskCommentMentioned = "task.comment_mentioned"
+
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+)
+
+// Envelope is the JSON document written to the bus for every event.
+type Envelope struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Version     int             `json:"version"`
+	DataVersion int             `json:"data_version"`
+	Source      string          `json:"source"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	ActorID     uint            `json:"actor_id,omitempty"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// TaskData is the payload of task.* events (data_version 1).
+type TaskData struct {
+	TaskID           uint       `json:"task_id"`
+	Title            string     `json:"title"`
+	ProjectID        uint       `json:"project_id,omitempty"`
+	AssignedTo       uint       `json:"assigned_to,omitempty"`
+	PreviousAssignee uint       `json:"previous_assignee,omitempty"`
+	CreatedBy        uint       `json:"created_by,omitempty"`
+	Status           string     `json:"status"`
+	PreviousStatus   string     `json:"previous_status,omitempty"`
+	Priority         string     `json:"priority,omitempty"`
+	DueDate          *time.Time `json:"due_date,omitempty"`
+}
+
+// CommentData is the payload of task.comment_added and
+// task.comment_mentioned (data_version 1).
+// ParentAuthorID is set for replies; Mentions lists the IDs of the users
+// mentioned with @username. task.comment_mentioned follows an edit and
+// lists only the users mentioned for the first time.
+type CommentData struct {
+	CommentID      uint   `json:"comment_id"`
+	TaskID         uint   `json:"task_id"`
+	Title          string `json:"title"`
+	AuthorID       uint   `json:"author_id"`
+	AssignedTo     uint   `json:"assigned_to,omitempty"`
+	CreatedBy      uint   `json:"created_by,omitempty"`
+	Excerpt        string `json:"excerpt"`
+	ParentID       uint   `json:"parent_id,omitempty"`
+	ParentAuthorID uint   `json:"parent_author_id,omitempty"`
+	Mentions       []uint `json:"mentions,omitempty"`
+}
+
+// UserData is the payload of user.* events (data_version 1).
+type UserData struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// Publisher delivers events to the bus.
+type Publisher interface {
+	Publish(ctx context.Context, event Envelope) error
+	Close() error
+}
+
+// New builds an envelope for data, which is marshalled as JSON.
+func New(eventType, source string, actorID uint, data interface{}) (Envelope, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:          newID(),
+		Type:        eventType,
+		Version:     EnvelopeVersion,
+		DataVersion: 1,
+		Source:      source,
+		OccurredAt:  time.Now().UTC(),
+		ActorID:     actorID,
+		Data:        raw,
+	}, nil
+}
+
+// Decode unmarshals the event payload into dest.
+func (e Envelope) Decode(dest interface{}) error {
+	return json.Unmarshal(e.Data, dest)
+}
+
+func newID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Nop discards every event. It is used when no bus is configured.
+type Nop struct{}
+
+func (Nop) Publish(context.Context, Envelope) error { return nil }
+func (Nop) Close() error                            { return nil }
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is an in-process bus for tests and single-instance setups. It keeps
+// every published event and fans them out to subscribers.
+type Memory struct {
+	mu          sync.Mutex
+	events      []Envelope
+	subscribers []chan Envelope
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(_ context.Context, event Envelope) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, event)
+	for _, ch := range m.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Slow subscribers miss events rather than block publishers.
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving events published from now on.
+func (m *Memory) Subscribe(buffer int) <-chan Envelope {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ch := make(chan Envelope, buffer)
+	m.subscribers = append(m.subscribers, ch)
+	return ch
+}
+
+// Events returns a copy of everything published so far.
+func (m *Memory) Events() []Envelope {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Envelope(nil), m.events...)
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ch := range m.subscribers {
+		close(ch)
+	}
+	m.subscribers = nil
+	return nil
+}
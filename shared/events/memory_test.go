@@ -0,0 +1,87 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewEnvelope(t *testing.T) {
+	event, err := New(TaskAssigned, "task-service", 3, TaskData{TaskID: 9, Title: "Ship it", AssignedTo: 4})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if event.ID == "" || event.Type != TaskAssigned || event.Source != "task-service" || event.ActorID != 3 {
+		t.Errorf("envelope = %+v", event)
+	}
+	if event.Version != EnvelopeVersion || event.DataVersion != 1 {
+		t.Errorf("versions = %d/%d, want %d/1", event.Version, event.DataVersion, EnvelopeVersion)
+	}
+
+	var data TaskData
+	if err := event.Decode(&data); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if data.TaskID != 9 || data.AssignedTo != 4 {
+		t.Errorf("data = %+v", data)
+	}
+
+	other, _ := New(TaskAssigned, "task-service", 3, nil)
+	if other.ID == event.ID {
+		t.Error("envelopes share an ID")
+	}
+}
+
+func TestMemoryPublishAndSubscribe(t *testing.T) {
+	bus := NewMemory()
+	before, _ := New(UserCreated, "user-service", 0, UserData{UserID: 1})
+	bus.Publish(context.Background(), before)
+
+	ch := bus.Subscribe(1)
+	after, _ := New(UserUpdated, "user-service", 1, UserData{UserID: 1})
+	bus.Publish(context.Background(), after)
+	// The buffer is full; this one is dropped for the subscriber only.
+	dropped, _ := New(UserDeleted, "user-service", 1, UserData{UserID: 1})
+	bus.Publish(context.Background(), dropped)
+
+	if got := <-ch; got.ID != after.ID {
+		t.Errorf("subscriber got %s, want %s", got.Type, after.Type)
+	}
+	if got := bus.Events(); len(got) != 3 {
+		t.Errorf("Events() has %d events, want 3", len(got))
+	}
+
+	bus.Close()
+	if _, ok := <-ch; ok {
+		t.Error("subscriber channel is open after Close")
+	}
+}
+
+func TestMemoryRun(t *testing.T) {
+	bus := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan Envelope, 1)
+	go bus.Run(ctx, func(_ context.Context, event Envelope) error {
+		received <- event
+		return nil
+	})
+
+	// Run subscribes asynchronously; publish until the handler sees an event.
+	event, _ := New(TaskCreated, "task-service", 1, TaskData{TaskID: 1})
+	deadline := time.After(time.Second)
+	for {
+		bus.Publish(ctx, event)
+		select {
+		case got := <-received:
+			if got.ID != event.ID {
+				t.Errorf("handler got %s, want %s", got.ID, event.ID)
+			}
+			return
+		case <-deadline:
+			t.Fatal("handler was not called")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
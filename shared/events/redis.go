@@ -0,0 +1,49 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultStream is the Redis stream all services publish to.
+const DefaultStream = "events"
+
+// RedisStream publishes events to a Redis stream with XADD. Each entry has
+// a "type" field for cheap filtering and an "envelope" field with the JSON.
+type RedisStream struct {
+	client redis.UniversalClient
+	stream string
+	maxLen int64
+}
+
+// NewRedisStream creates a publisher. maxLen caps the stream length
+// (approximately); zero leaves the stream unbounded.
+func NewRedisStream(client redis.UniversalClient, stream string, maxLen int64) *RedisStream {
+	if stream == "" {
+		stream = DefaultStream
+	}
+	return &RedisStream{client: client, stream: stream, maxLen: maxLen}
+}
+
+func (r *RedisStream) Publish(ctx context.Context, event Envelope) error {
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return r.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.stream,
+		MaxLen: r.maxLen,
+		Approx: r.maxLen > 0,
+		Values: map[string]interface{}{
+			"type":     event.Type,
+			"envelope": raw,
+		},
+	}).Err()
+}
+
+// Close is a no-op; the Redis client is owned by the caller.
+func (r *RedisStream) Close() error {
+	return nil
+}
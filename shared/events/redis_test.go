@@ -0,0 +1,204 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func newTestConsumer(client *redis.Client) *RedisConsumer {
+	consumer := NewRedisConsumer(client, "", "test-group", "test-consumer")
+	consumer.block = 10 * time.Millisecond
+	return consumer
+}
+
+// consumeOnce reads the stream once with handle.
+func consumeOnce(t *testing.T, consumer *RedisConsumer, handle Handler) {
+	t.Helper()
+	ctx := context.Background()
+	if err := consumer.client.XGroupCreateMkStream(ctx, consumer.stream, consumer.group, "0").Err(); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	consumer.read(ctx, ">", handle)
+}
+
+func pending(t *testing.T, client *redis.Client) int64 {
+	t.Helper()
+	summary, err := client.XPending(context.Background(), DefaultStream, "test-group").Result()
+	if err != nil {
+		t.Fatalf("XPending: %v", err)
+	}
+	return summary.Count
+}
+
+func TestRedisStreamPublish(t *testing.T) {
+	client := newTestRedis(t)
+	stream := NewRedisStream(client, "", 0)
+	ctx := context.Background()
+
+	var published []Envelope
+	for i := uint(1); i <= 3; i++ {
+		event, _ := New(TaskCreated, "task-service", 2, TaskData{TaskID: i})
+		if err := stream.Publish(ctx, event); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		published = append(published, event)
+	}
+
+	entries, err := client.XRange(ctx, DefaultStream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("XRange: %v", err)
+	}
+	if len(entries) != len(published) {
+		t.Fatalf("stream has %d entries, want %d", len(entries), len(published))
+	}
+	last := entries[len(entries)-1].Values
+	if last["type"] != TaskCreated {
+		t.Errorf("type field = %v, want %s", last["type"], TaskCreated)
+	}
+	var got Envelope
+	if err := json.Unmarshal([]byte(last["envelope"].(string)), &got); err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	if got.ID != published[2].ID {
+		t.Errorf("last entry is %s, want %s", got.ID, published[2].ID)
+	}
+}
+
+func TestRedisStreamDelivery(t *testing.T) {
+	client := newTestRedis(t)
+	event, _ := New(TaskCreated, "task-service", 2, TaskData{TaskID: 5})
+	if err := NewRedisStream(client, "", 0).Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	var got []Envelope
+	consumeOnce(t, newTestConsumer(client), func(_ context.Context, event Envelope) error {
+		got = append(got, event)
+		return nil
+	})
+
+	if len(got) != 1 || got[0].ID != event.ID || got[0].Type != TaskCreated {
+		t.Fatalf("handled %+v, want %s", got, event.ID)
+	}
+	if n := pending(t, client); n != 0 {
+		t.Errorf("%d entries left pending, want 0", n)
+	}
+}
+
+func TestRedisConsumerRetriesTransientErrors(t *testing.T) {
+	client := newTestRedis(t)
+	event, _ := New(TaskCreated, "task-service", 2, TaskData{TaskID: 5})
+	NewRedisStream(client, "", 0).Publish(context.Background(), event)
+
+	consumeOnce(t, newTestConsumer(client), func(context.Context, Envelope) error {
+		return errors.New("database unavailable")
+	})
+
+	if n := pending(t, client); n != 1 {
+		t.Errorf("%d entries pending, want 1 left for redelivery", n)
+	}
+	if n := client.XLen(context.Background(), DefaultStream+DeadLetterSuffix).Val(); n != 0 {
+		t.Errorf("%d entries dead-lettered, want 0", n)
+	}
+}
+
+func TestRedisConsumerDeadLettersAfterMaxDeliveries(t *testing.T) {
+	client := newTestRedis(t)
+	event, _ := New(TaskCreated, "task-service", 2, TaskData{TaskID: 5})
+	NewRedisStream(client, "", 0).Publish(context.Background(), event)
+
+	consumer := newTestConsumer(client)
+	consumer.maxDeliveries = 3
+	var deliveries int
+	failing := func(context.Context, Envelope) error {
+		deliveries++
+		return errors.New("database unavailable")
+	}
+
+	consumeOnce(t, consumer, failing)
+	// Entries pending for the consumer are delivered again from "0".
+	for i := 1; i < 5 && pending(t, client) > 0; i++ {
+		consumer.read(context.Background(), "0", failing)
+	}
+
+	if deliveries != 3 {
+		t.Errorf("handler called %d times, want 3", deliveries)
+	}
+	if n := pending(t, client); n != 0 {
+		t.Errorf("%d entries pending, want the exhausted entry acknowledged", n)
+	}
+	entries, err := client.XRange(context.Background(), DefaultStream+DeadLetterSuffix, "-", "+").Result()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("dead letters = %v, %v; want one entry", entries, err)
+	}
+	if entries[0].Values["error"] != "database unavailable" {
+		t.Errorf("dead letter = %v", entries[0].Values)
+	}
+}
+
+func TestRedisConsumerDropsMalformedEntries(t *testing.T) {
+	client := newTestRedis(t)
+	client.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: DefaultStream,
+		Values: map[string]interface{}{"type": TaskCreated, "envelope": "{not json"},
+	})
+
+	called := false
+	consumeOnce(t, newTestConsumer(client), func(context.Context, Envelope) error {
+		called = true
+		return nil
+	})
+
+	if called {
+		t.Error("the handler got a malformed entry")
+	}
+	if n := pending(t, client); n != 0 {
+		t.Errorf("%d entries pending, want the malformed entry acknowledged", n)
+	}
+}
+
+func TestRedisConsumerDeadLettersPermanentErrors(t *testing.T) {
+	client := newTestRedis(t)
+	event, _ := New(TaskCreated, "task-service", 2, TaskData{TaskID: 5})
+	NewRedisStream(client, "", 0).Publish(context.Background(), event)
+
+	consumeOnce(t, newTestConsumer(client), func(context.Context, Envelope) error {
+		return Permanent(errors.New("template: bad field"))
+	})
+
+	if n := pending(t, client); n != 0 {
+		t.Errorf("%d entries pending, want the failed entry acknowledged", n)
+	}
+	entries, err := client.XRange(context.Background(), DefaultStream+DeadLetterSuffix, "-", "+").Result()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("dead letters = %v, %v; want one entry", entries, err)
+	}
+	if entries[0].Values["error"] != "template: bad field" || entries[0].Values["group"] != "test-group" {
+		t.Errorf("dead letter = %v", entries[0].Values)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("bad template")
+	err := Permanent(cause)
+	if !IsPermanent(err) || !errors.Is(err, cause) {
+		t.Errorf("Permanent(%v) lost its cause or mark", cause)
+	}
+	if IsPermanent(cause) {
+		t.Error("an unmarked error is permanent")
+	}
+}
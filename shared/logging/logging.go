@@ -0,0 +1,123 @@
+// Package logging sets up structured JSON logging and request IDs for the
+// services.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/trace"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+var level = new(slog.LevelVar)
+
+// Init makes a JSON logger the default for slog and the standard log
+// package. Every line carries the service name and, when logged with a
+// request context, the request and trace IDs. The level is read from
+// LOG_LEVEL (debug, info, warn, error; info by default).
+func Init(service string) {
+	var invalid string
+	if raw := os.Getenv("LOG_LEVEL"); raw != "" {
+		if err := level.UnmarshalText([]byte(raw)); err != nil {
+			invalid = raw
+		}
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(contextHandler{handler}).With("service", service))
+
+	// gin prints its debug output (routes, warnings) as plain text.
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)))
+	}
+	gin.DebugPrintRouteFunc = func(method, path, handler string, handlers int) {
+		slog.Debug("Route registered", "method", method, "path", path, "handler", handler)
+	}
+	redis.SetLogger(redisLogger{})
+
+	if invalid != "" {
+		slog.Warn("Invalid LOG_LEVEL, using info", "value", invalid)
+	}
+}
+
+// Fatal logs msg at error level and exits.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// GormLogger sends GORM warnings, slow queries and errors to slog. All
+// queries are logged at debug level.
+func GormLogger() gormlogger.Interface {
+	gormLevel := gormlogger.Warn
+	if level.Level() <= slog.LevelDebug {
+		gormLevel = gormlogger.Info
+	}
+	return gormLogger{gormlogger.NewSlogLogger(slog.Default(), gormlogger.Config{
+		SlowThreshold:             200 * time.Millisecond,
+		LogLevel:                  gormLevel,
+		IgnoreRecordNotFoundError: true,
+	})}
+}
+
+// gormLogger formats GORM's printf-style messages, which the slog logger of
+// GORM passes through unformatted. Query tracing is left to the slog logger.
+type gormLogger struct {
+	gormlogger.Interface
+}
+
+func (l gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	return gormLogger{l.Interface.LogMode(level)}
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	slog.DebugContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	slog.WarnContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	slog.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+}
+
+// redisLogger sends the connection pool messages of go-redis to slog.
+type redisLogger struct{}
+
+func (redisLogger) Printf(ctx context.Context, format string, v ...interface{}) {
+	slog.WarnContext(ctx, fmt.Sprintf(format, v...))
+}
+
+// contextHandler adds the request and trace IDs found in the context of a
+// record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			r.AddAttrs(slog.String("request_id", id))
+		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"shared/metrics"
+)
+
+// HeaderRequestID carries the request ID between the gateway and the
+// services, and back to the client.
+const HeaderRequestID = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// quietPaths are polled by probes and scrapers; their access lines are
+// logged at debug level.
+var quietPaths = map[string]bool{
+	"/health":  true,
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// Middleware assigns the request ID and writes one access log line per
+// request. A valid X-Request-ID from the caller is kept, so the gateway and
+// the services log the same ID; otherwise a new one is generated. The ID is
+// set on the request headers (and so forwarded by the gateway), echoed in
+// the response and added to JSON error bodies.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Request.Header.Set(HeaderRequestID, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Header(HeaderRequestID, id)
+		c.Writer = &errorWriter{ResponseWriter: c.Writer, requestID: id}
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.GetString(metrics.RouteKey)
+		}
+		status := c.Writer.Status()
+		lvl := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			lvl = slog.LevelError
+		case quietPaths[c.Request.URL.Path]:
+			lvl = slog.LevelDebug
+		}
+		slog.LogAttrs(c.Request.Context(), lvl, "HTTP request",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// Recovery turns a panic into a logged error and a 500 response.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "Panic recovered",
+			"error", err, "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	})
+}
+
+// validRequestID accepts short IDs of safe characters only, so a caller
+// cannot inject arbitrary text into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// errorWriter adds the request ID to JSON error bodies, so handlers can keep
+// answering with gin.H{"error": ...}.
+type errorWriter struct {
+	gin.ResponseWriter
+	requestID string
+}
+
+func (w *errorWriter) Write(data []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest || w.Written() ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(data)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil || body == nil || body["request_id"] != nil {
+		return w.ResponseWriter.Write(data)
+	}
+	body["request_id"], _ = json.Marshal(w.requestID)
+	out, err := json.Marshal(body)
+	if err != nil {
+		return w.ResponseWriter.Write(data)
+	}
+
+	// The body no longer matches a length copied from a backend.
+	w.Header().Del("Content-Length")
+	if _, err := w.ResponseWriter.Write(out); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,210 @@
+// Package mergepatch applies JSON Merge Patch documents (RFC 7396) to the
+// editable fields of a resource.
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ContentType is the media type of a merge patch. Plain application/json
+// is accepted as well.
+const ContentType = "application/merge-patch+json"
+
+// ErrUnsupportedMediaType is returned for bodies that are not JSON.
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Error is a patch that cannot be applied. Fields maps the JSON name of
+// each offending field to the rule it broke: "unknown" for fields that
+// cannot be patched, "type" for values of the wrong type, otherwise the
+// failed validation tag such as "required" or "oneof".
+type Error struct {
+	Message string
+	Fields  map[string]string
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	names := make([]string, 0, len(e.Fields))
+	for name, rule := range e.Fields {
+		names = append(names, name+": "+rule)
+	}
+	sort.Strings(names)
+	return e.Message + " (" + strings.Join(names, ", ") + ")"
+}
+
+// Abort answers a patch that Bind refused: 415 for a body that is not
+// JSON, 400 with the offending fields otherwise. The messages are in
+// Russian like the rest of the services' API.
+func Abort(c *gin.Context, err error) {
+	var patchErr *Error
+	switch {
+	case errors.Is(err, ErrUnsupportedMediaType):
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "Ожидается тело " + ContentType,
+		})
+	case errors.As(err, &patchErr):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":  "Неверные данные: " + patchErr.Message,
+			"code":   "invalid_patch",
+			"fields": patchErr.Fields,
+		})
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+	}
+}
+
+// Merge applies patch to target as described in RFC 7396: members of a
+// patch object replace the members of target, null removes them, and a
+// patch that is not an object replaces target as a whole.
+func Merge(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = Merge(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// Bind applies the merge patch in the request body to target, a pointer to
+// a struct holding the current values of the editable fields. A field set
+// to null gets its zero value. Members that are not JSON fields of target
+// are refused, and the patched fields are checked against their binding
+// tags. Bind returns the JSON names of the patched fields, sorted.
+func Bind(c *gin.Context, target interface{}) ([]string, error) {
+	if contentType := c.ContentType(); contentType != ContentType && contentType != binding.MIMEJSON {
+		return nil, ErrUnsupportedMediaType
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var patch interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, &Error{Message: "invalid JSON: " + err.Error()}
+	}
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return nil, &Error{Message: "patch must be a JSON object"}
+	}
+
+	value := reflect.ValueOf(target).Elem()
+	fieldNames := jsonFieldNames(value.Type())
+	fields := make([]string, 0, len(patchObject))
+	unknown := make(map[string]string)
+	for name := range patchObject {
+		if _, ok := fieldNames[name]; !ok {
+			unknown[name] = "unknown"
+			continue
+		}
+		fields = append(fields, name)
+	}
+	if len(unknown) > 0 {
+		return nil, &Error{Message: "fields cannot be patched", Fields: unknown}
+	}
+	sort.Strings(fields)
+
+	current, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	if err := json.Unmarshal(current, &document); err != nil {
+		return nil, err
+	}
+	merged, err := json.Marshal(Merge(document, patchObject))
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode into a fresh value so that removed members end up zero.
+	patched := reflect.New(value.Type())
+	if err := json.Unmarshal(merged, patched.Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, &Error{Message: "invalid field value", Fields: map[string]string{typeErr.Field: "type"}}
+		}
+		return nil, &Error{Message: "invalid patch: " + err.Error()}
+	}
+
+	if err := validate(patched.Interface(), fields, fieldNames); err != nil {
+		return nil, err
+	}
+	value.Set(patched.Elem())
+	return fields, nil
+}
+
+// validate checks the binding tags of the patched fields only, so a value
+// stored before a rule was introduced does not block unrelated changes.
+func validate(target interface{}, fields []string, fieldNames map[string]string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return binding.Validator.ValidateStruct(target)
+	}
+
+	structFields := make([]string, 0, len(fields))
+	for _, name := range fields {
+		structFields = append(structFields, fieldNames[name])
+	}
+	err := engine.StructPartial(target, structFields...)
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	byStructField := make(map[string]string, len(fieldNames))
+	for jsonName, structName := range fieldNames {
+		byStructField[structName] = jsonName
+	}
+	invalid := make(map[string]string, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		invalid[byStructField[fieldErr.StructField()]] = fieldErr.Tag()
+	}
+	return &Error{Message: "validation failed", Fields: invalid}
+}
+
+// jsonFieldNames maps the JSON names of the exported fields of t to the
+// struct field names.
+func jsonFieldNames(t reflect.Type) map[string]string {
+	names := make(map[string]string, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		names[name] = field.Name
+	}
+	return names
+}
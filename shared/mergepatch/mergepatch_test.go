@@ -0,0 +1,189 @@
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// The examples from RFC 7396, appendix A.
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		var target, patch, want interface{}
+		json.Unmarshal([]byte(tt.target), &target)
+		json.Unmarshal([]byte(tt.patch), &patch)
+		json.Unmarshal([]byte(tt.want), &want)
+		if got := Merge(target, patch); !reflect.DeepEqual(got, want) {
+			t.Errorf("Merge(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+type settings struct {
+	Theme    string `json:"theme"`
+	Language string `json:"language"`
+}
+
+type profile struct {
+	Name     string   `json:"name" binding:"required"`
+	Bio      string   `json:"bio"`
+	Age      int      `json:"age" binding:"min=0"`
+	Manager  *uint    `json:"manager_id"`
+	Settings settings `json:"settings"`
+	internal string
+}
+
+func newProfile() profile {
+	manager := uint(7)
+	return profile{
+		Name:     "Alice",
+		Bio:      "Engineer",
+		Age:      30,
+		Manager:  &manager,
+		Settings: settings{Theme: "light", Language: "ru"},
+		internal: "kept",
+	}
+}
+
+func bind(t *testing.T, contentType, body string, target interface{}) ([]string, error) {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	return Bind(c, target)
+}
+
+func TestBindAbsentAndNull(t *testing.T) {
+	p := newProfile()
+	fields, err := bind(t, ContentType, `{"bio":null,"manager_id":null,"age":31}`, &p)
+	if err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if want := []string{"age", "bio", "manager_id"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+	if p.Bio != "" || p.Manager != nil {
+		t.Errorf("null did not clear: bio %q, manager %v", p.Bio, p.Manager)
+	}
+	if p.Age != 31 {
+		t.Errorf("age = %d, want 31", p.Age)
+	}
+	if p.Name != "Alice" || p.Settings != (settings{Theme: "light", Language: "ru"}) {
+		t.Errorf("absent fields changed: %+v", p)
+	}
+}
+
+func TestBindNestedObject(t *testing.T) {
+	p := newProfile()
+	fields, err := bind(t, "application/json", `{"settings":{"theme":"dark"}}`, &p)
+	if err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if !reflect.DeepEqual(fields, []string{"settings"}) {
+		t.Errorf("fields = %v, want [settings]", fields)
+	}
+	if want := (settings{Theme: "dark", Language: "ru"}); p.Settings != want {
+		t.Errorf("settings = %+v, want %+v", p.Settings, want)
+	}
+
+	if _, err := bind(t, ContentType, `{"settings":{"language":null}}`, &p); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if want := (settings{Theme: "dark"}); p.Settings != want {
+		t.Errorf("settings after removing a member = %+v, want %+v", p.Settings, want)
+	}
+
+	if _, err := bind(t, ContentType, `{"settings":null}`, &p); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if p.Settings != (settings{}) {
+		t.Errorf("settings after null = %+v, want zero", p.Settings)
+	}
+}
+
+func TestBindEmptyPatch(t *testing.T) {
+	p := newProfile()
+	fields, err := bind(t, ContentType, `{}`, &p)
+	if err != nil || len(fields) != 0 {
+		t.Fatalf("Bind({}) = %v, %v; want no fields", fields, err)
+	}
+	if p.Name != "Alice" || p.Manager == nil || *p.Manager != 7 {
+		t.Errorf("empty patch changed the target: %+v", p)
+	}
+}
+
+func TestBindRejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantFields  map[string]string
+	}{
+		{"unknown field", ContentType, `{"id":5,"bio":"x"}`, map[string]string{"id": "unknown"}},
+		{"unexported field", ContentType, `{"internal":"x"}`, map[string]string{"internal": "unknown"}},
+		{"wrong type", ContentType, `{"age":"old"}`, map[string]string{"age": "type"}},
+		{"required set to null", ContentType, `{"name":null}`, map[string]string{"name": "required"}},
+		{"below minimum", ContentType, `{"age":-1}`, map[string]string{"age": "min"}},
+		{"not an object", ContentType, `["bio"]`, nil},
+		{"invalid JSON", ContentType, `{"bio":`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProfile()
+			_, err := bind(t, tt.contentType, tt.body, &p)
+			var patchErr *Error
+			if !errors.As(err, &patchErr) {
+				t.Fatalf("Bind(%s) = %v, want *Error", tt.body, err)
+			}
+			if tt.wantFields != nil && !reflect.DeepEqual(patchErr.Fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", patchErr.Fields, tt.wantFields)
+			}
+			if p.Bio != "Engineer" || p.Age != 30 {
+				t.Errorf("a refused patch changed the target: %+v", p)
+			}
+		})
+	}
+
+	p := newProfile()
+	if _, err := bind(t, "text/plain", `{"bio":"x"}`, &p); !errors.Is(err, ErrUnsupportedMediaType) {
+		t.Errorf("text/plain: err = %v, want ErrUnsupportedMediaType", err)
+	}
+}
+
+func TestBindValidatesPatchedFieldsOnly(t *testing.T) {
+	// A stored value that breaks a rule does not block other changes.
+	p := newProfile()
+	p.Name = ""
+	if _, err := bind(t, ContentType, `{"bio":"x"}`, &p); err != nil {
+		t.Errorf("Bind with an invalid untouched field: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Package metrics exposes Prometheus metrics for the services.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// RouteKey can be set on the gin context by handlers that serve many paths
+// without a registered route (such as the gateway proxy) to name the route
+// in metric labels.
+const RouteKey = "metrics.route"
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests processed, by route and status.",
+	}, []string{"method", "route", "status"})
+
+	duration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Middleware records the count and latency of every request. Routes are
+// labelled with the registered pattern (c.FullPath()), never the raw path,
+// so IDs in URLs do not create new series.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.GetString(RouteKey)
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		requests.WithLabelValues(c.Request.Method, route, status).Inc()
+		duration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// RegisterDB exports the connection pool statistics of db (sql.DB.Stats).
+func RegisterDB(db *gorm.DB, name string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return prometheus.Register(collectors.NewDBStatsCollector(sqlDB, name))
+}
+
+// RegisterCache exports the lookup counters of a cache named name, along
+// with its hit ratio.
+func RegisterCache(name string, hits, misses, errors func() int64) error {
+	results := map[string]func() int64{"hit": hits, "miss": misses, "error": errors}
+	for result, count := range results {
+		collector := prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "cache_requests_total",
+			Help:        "Cache lookups, by result.",
+			ConstLabels: prometheus.Labels{"cache": name, "result": result},
+		}, func() float64 { return float64(count()) })
+		if err := prometheus.Register(collector); err != nil {
+			return err
+		}
+	}
+
+	return prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "cache_hit_ratio",
+		Help:        "Share of cache lookups answered from the cache.",
+		ConstLabels: prometheus.Labels{"cache": name},
+	}, func() float64 {
+		h, m := hits(), misses()
+		if h+m == 0 {
+			return 0
+		}
+		return float64(h) / float64(h+m)
+	}))
+}
@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "telemetry:span"
+
+// tracerName names the instrumentation scope of the GORM spans. The tracer
+// is looked up for every span so that it follows the current provider.
+const tracerName = "shared/telemetry"
+
+// gormTracing is a GORM plugin that wraps every statement in a client span,
+// a child of the span carried by the statement's context.
+type gormTracing struct{}
+
+func (gormTracing) Name() string { return "telemetry" }
+
+func (gormTracing) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("telemetry:before_create", startSpan("create")),
+		cb.Create().After("gorm:create").Register("telemetry:after_create", endSpan),
+		cb.Query().Before("gorm:query").Register("telemetry:before_query", startSpan("query")),
+		cb.Query().After("gorm:query").Register("telemetry:after_query", endSpan),
+		cb.Update().Before("gorm:update").Register("telemetry:before_update", startSpan("update")),
+		cb.Update().After("gorm:update").Register("telemetry:after_update", endSpan),
+		cb.Delete().Before("gorm:delete").Register("telemetry:before_delete", startSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("telemetry:after_delete", endSpan),
+		cb.Row().Before("gorm:row").Register("telemetry:before_row", startSpan("row")),
+		cb.Row().After("gorm:row").Register("telemetry:after_row", endSpan),
+		cb.Raw().Before("gorm:raw").Register("telemetry:before_raw", startSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("telemetry:after_raw", endSpan),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			// Queries outside a request would each start a new trace.
+			return
+		}
+		_, span := otel.Tracer(tracerName).Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "postgresql")),
+		)
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.String("db.sql.table", db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
@@ -0,0 +1,91 @@
+// Package telemetry sets up OpenTelemetry tracing for the services.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gorm.io/gorm"
+)
+
+// Init installs the global tracer provider for service. The exporter is
+// chosen by OTEL_TRACES_EXPORTER: "otlp" (endpoint from the standard
+// OTEL_EXPORTER_OTLP_* variables), "stdout" or "none" (default). W3C trace
+// context is propagated in every case, so traces pass through services that
+// do not export. The returned function flushes pending spans.
+func Init(ctx context.Context, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name := os.Getenv("OTEL_TRACES_EXPORTER"); name {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create trace exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(attribute.String("service.name", service)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create trace resource: %w", err)
+	}
+
+	// The sampler follows OTEL_TRACES_SAMPLER and defaults to honouring the
+	// caller's sampling decision.
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starts a server span for every request, continuing the trace
+// of the caller when it sent a traceparent header.
+func Middleware(service string) gin.HandlerFunc {
+	return otelgin.Middleware(service)
+}
+
+// InstrumentDB records a child span for every query run with a context,
+// e.g. db.WithContext(c).
+func InstrumentDB(db *gorm.DB) error {
+	return db.Use(gormTracing{})
+}
+
+// Transport wraps base so outgoing requests get client spans and carry the
+// traceparent header of the current span.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+// InstrumentRedis records a child span for every Redis command.
+func InstrumentRedis(client redis.UniversalClient) error {
+	return redisotel.InstrumentTracing(client)
+}
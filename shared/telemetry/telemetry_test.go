@@ -0,0 +1,198 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// useInMemoryTracing installs a tracer provider that records every span in
+// memory, synchronously, for the duration of the test.
+func useInMemoryTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter
+}
+
+// spanNamed returns the only recorded span called name.
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	var found []tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == name {
+			found = append(found, span)
+		}
+	}
+	if len(found) != 1 {
+		names := make([]string, 0, len(spans))
+		for _, span := range spans {
+			names = append(names, span.Name)
+		}
+		t.Fatalf("found %d spans named %q among %v, want 1", len(found), name, names)
+	}
+	return found[0]
+}
+
+func assertChild(t *testing.T, child, parent tracetest.SpanStub) {
+	t.Helper()
+	if child.SpanContext.TraceID() != parent.SpanContext.TraceID() {
+		t.Errorf("%s is in trace %s, want %s", child.Name, child.SpanContext.TraceID(), parent.SpanContext.TraceID())
+	}
+	if child.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("parent of %s is %s, want %s (%s)", child.Name, child.Parent.SpanID(), parent.Name, parent.SpanContext.SpanID())
+	}
+}
+
+// TestTracePropagatesThroughServices follows a request from a gateway
+// through its proxy transport into a backend service.
+func TestTracePropagatesThroughServices(t *testing.T) {
+	exporter := useInMemoryTracing(t)
+
+	backend := gin.New()
+	backend.Use(Middleware("task-service"))
+	backend.GET("/tasks", func(c *gin.Context) { c.Status(http.StatusOK) })
+	backendServer := httptest.NewServer(backend)
+	defer backendServer.Close()
+
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	gateway := gin.New()
+	gateway.Use(Middleware("api-gateway"))
+	gateway.GET("/tasks", func(c *gin.Context) {
+		req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, backendServer.URL+"/tasks", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("backend request: %v", err)
+			c.Status(http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		c.Status(resp.StatusCode)
+	})
+
+	// The caller already has a trace; the gateway must continue it.
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+	req.Header.Set("traceparent", "00-"+parent.TraceID().String()+"-"+parent.SpanID().String()+"-01")
+	w := httptest.NewRecorder()
+	gateway.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans, want gateway server, client and backend server", len(spans))
+	}
+	var gatewaySpan, clientSpan, backendSpan tracetest.SpanStub
+	for _, span := range spans {
+		switch {
+		case span.SpanKind == trace.SpanKindClient:
+			clientSpan = span
+		case span.Parent.SpanID() == parent.SpanID():
+			gatewaySpan = span
+		default:
+			backendSpan = span
+		}
+	}
+	if gatewaySpan.SpanContext.TraceID() != parent.TraceID() || gatewaySpan.SpanKind != trace.SpanKindServer {
+		t.Fatalf("the gateway did not continue the caller's trace: %+v", gatewaySpan.SpanContext)
+	}
+	assertChild(t, clientSpan, gatewaySpan)
+	assertChild(t, backendSpan, clientSpan)
+	if backendSpan.SpanKind != trace.SpanKindServer {
+		t.Errorf("backend span kind = %v, want server", backendSpan.SpanKind)
+	}
+}
+
+type tracedRow struct {
+	ID   uint
+	Name string
+}
+
+func TestGormSpansAreChildrenOfTheRequest(t *testing.T) {
+	exporter := useInMemoryTracing(t)
+
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := InstrumentDB(db); err != nil {
+		t.Fatalf("InstrumentDB: %v", err)
+	}
+
+	// Without a span in the context queries are not traced.
+	db.WithContext(context.Background()).Find(&[]tracedRow{})
+	if n := len(exporter.GetSpans()); n != 0 {
+		t.Fatalf("a query outside a request recorded %d spans", n)
+	}
+
+	ctx, request := otel.Tracer("test").Start(context.Background(), "request")
+	db.WithContext(ctx).Where("name = ?", "x").Find(&[]tracedRow{})
+	db.WithContext(ctx).Create(&tracedRow{Name: "y"})
+	request.End()
+
+	spans := exporter.GetSpans()
+	parent := spanNamed(t, spans, "request")
+	for _, name := range []string{"gorm.query", "gorm.create"} {
+		span := spanNamed(t, spans, name)
+		assertChild(t, span, parent)
+		if span.SpanKind != trace.SpanKindClient {
+			t.Errorf("%s kind = %v, want client", name, span.SpanKind)
+		}
+	}
+	for _, attr := range spanNamed(t, spans, "gorm.query").Attributes {
+		if attr.Key == "db.sql.table" && attr.Value.AsString() != "traced_rows" {
+			t.Errorf("db.sql.table = %s, want traced_rows", attr.Value.AsString())
+		}
+	}
+}
+
+func TestRedisSpansAreChildrenOfTheRequest(t *testing.T) {
+	exporter := useInMemoryTracing(t)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	if err := InstrumentRedis(client); err != nil {
+		t.Fatalf("InstrumentRedis: %v", err)
+	}
+
+	ctx, request := otel.Tracer("test").Start(context.Background(), "request")
+	if err := client.Set(ctx, "key", "value", 0).Err(); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	request.End()
+
+	spans := exporter.GetSpans()
+	assertChild(t, spanNamed(t, spans, "set"), spanNamed(t, spans, "request"))
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shared/events"
+)
+
+const (
+	maxCommentMentions = 20
+	commentExcerptLen  = 140
+)
+
+// TaskComment is a message in the discussion of a task. Replies point to
+// their parent comment. Deleted comments are kept (soft deletion) so the
+// replies below them stay in place.
+type TaskComment struct {
+	ID        uint             `json:"id" gorm:"primaryKey"`
+	TaskID    uint             `json:"task_id" gorm:"index;not null"`
+	ParentID  *uint            `json:"parent_id,omitempty" gorm:"index"`
+	AuthorID  uint             `json:"author_id"`
+	Body      string           `json:"body" gorm:"type:text;not null"`
+	Mentions  []CommentMention `json:"mentions" gorm:"foreignKey:CommentID"`
+	EditedAt  *time.Time       `json:"edited_at,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	DeletedAt gorm.DeletedAt   `json:"deleted_at,omitempty" gorm:"index"`
+
+	Replies []*TaskComment `json:"replies,omitempty" gorm:"-"`
+}
+
+// CommentMention is a user mentioned in a comment with @username.
+type CommentMention struct {
+	CommentID uint   `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	UserID    uint   `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Username  string `json:"username"`
+}
+
+// TaskCommentEdit keeps the text a comment had before an edit.
+type TaskCommentEdit struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CommentID uint      `json:"comment_id" gorm:"index;not null"`
+	Body      string    `json:"body" gorm:"type:text"`
+	EditedBy  uint      `json:"edited_by"`
+	EditedAt  time.Time `json:"edited_at"`
+}
+
+type CommentRequest struct {
+	Body     string `json:"body" binding:"required,max=10000"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+// mentionPattern matches @username not preceded by a word character, so
+// e-mail addresses are not taken for mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9_][A-Za-z0-9_.-]*)`)
+
+// parseMentions returns the distinct usernames mentioned in body.
+func parseMentions(body string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// A trailing dot ends the sentence, not the name.
+		name := strings.TrimRight(match[1], ".-")
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+		if len(names) == maxCommentMentions {
+			break
+		}
+	}
+	return names
+}
+
+// resolveMentions looks the mentioned usernames up in the users table.
+// Mentions are best effort: when the lookup fails the comment is still
+// saved, without mentions.
+func resolveMentions(c *gin.Context, body string) []CommentMention {
+	names := parseMentions(body)
+	if len(names) == 0 {
+		return nil
+	}
+	users, err := lookupUsernames(c, names)
+	if err != nil {
+		slog.WarnContext(c, "Failed to resolve mentions", "error", err)
+		return nil
+	}
+	mentions := make([]CommentMention, 0, len(users))
+	for _, user := range users {
+		mentions = append(mentions, CommentMention{UserID: user.ID, Username: user.Username})
+	}
+	return mentions
+}
+
+// loadComment finds :comment_id among the comments of task. Deleted
+// comments are not found.
+func loadComment(c *gin.Context, task *Task) *TaskComment {
+	id, err := strconv.ParseUint(c.Param("comment_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор комментария"})
+		return nil
+	}
+
+	var comment TaskComment
+	err = db.WithContext(c).Preload("Mentions").
+		Where("task_id = ?", task.ID).First(&comment, id).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Комментарий не найден"})
+		return nil
+	}
+	return &comment
+}
+
+// canModifyComment allows the author and admins to edit or delete a comment.
+func canModifyComment(comment *TaskComment, userID uint, role string) bool {
+	return role == "admin" || comment.AuthorID == userID
+}
+
+func abortCommentForbidden(c *gin.Context, comment *TaskComment) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":      "Изменять комментарий может только его автор",
+		"code":       "forbidden",
+		"comment_id": comment.ID,
+	})
+}
+
+// getTaskComments serves GET /tasks/:id/comments as a tree: top-level
+// comments in order of creation, each with its replies. A deleted comment
+// is shown without its text while it still has replies.
+func getTaskComments(c *gin.Context) {
+	task, _, _ := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+
+	var comments []*TaskComment
+	err := db.WithContext(c).Unscoped().Preload("Mentions").
+		Where("task_id = ?", task.ID).Order("created_at, id").Find(&comments).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки комментариев"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":  task.ID,
+		"total":    countVisible(comments),
+		"comments": buildCommentTree(comments),
+	})
+}
+
+// buildCommentTree nests replies under their parents and drops deleted
+// comments that have no replies left.
+func buildCommentTree(comments []*TaskComment) []*TaskComment {
+	byID := make(map[uint]*TaskComment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+
+	roots := []*TaskComment{}
+	for _, comment := range comments {
+		if parent, ok := byID[derefID(comment.ParentID)]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+	return pruneDeleted(roots)
+}
+
+func pruneDeleted(comments []*TaskComment) []*TaskComment {
+	kept := comments[:0]
+	for _, comment := range comments {
+		comment.Replies = pruneDeleted(comment.Replies)
+		if comment.DeletedAt.Valid {
+			if len(comment.Replies) == 0 {
+				continue
+			}
+			comment.Body = ""
+			comment.Mentions = nil
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+func countVisible(comments []*TaskComment) int {
+	count := 0
+	for _, comment := range comments {
+		if !comment.DeletedAt.Valid {
+			count++
+		}
+	}
+	return count
+}
+
+func derefID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// createTaskComment serves POST /tasks/:id/comments and announces the
+// comment with task.comment_added, including the mentioned users.
+func createTaskComment(c *gin.Context) {
+	task, userID, _ := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+
+	var req CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: комментарий пуст"})
+		return
+	}
+
+	var parent TaskComment
+	if req.ParentID != nil {
+		err := db.WithContext(c).Where("task_id = ?", task.ID).First(&parent, *req.ParentID).Error
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "Комментарий, на который дан ответ, не найден",
+				"code":  "invalid_parent",
+			})
+			return
+		}
+	}
+
+	comment := TaskComment{
+		TaskID:   task.ID,
+		ParentID: req.ParentID,
+		AuthorID: userID,
+		Body:     body,
+		Mentions: resolveMentions(c, body),
+	}
+	if err := db.WithContext(c).Create(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания комментария: " + err.Error()})
+		return
+	}
+
+	data := commentEventData(c, task, &comment, comment.Mentions)
+	data.ParentID = parent.ID
+	data.ParentAuthorID = parent.AuthorID
+	publishCommentEvent(c, events.TaskCommentAdded, data)
+
+	if comment.Mentions == nil {
+		comment.Mentions = []CommentMention{}
+	}
+	c.JSON(http.StatusCreated, comment)
+}
+
+// updateTaskComment serves PUT /tasks/:id/comments/:comment_id. The previous
+// text goes to the edit history and mentions are resolved again.
+func updateTaskComment(c *gin.Context) {
+	task, userID, role := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+	comment := loadComment(c, task)
+	if comment == nil {
+		return
+	}
+	if !canModifyComment(comment, userID, role) {
+		abortCommentForbidden(c, comment)
+		return
+	}
+
+	var req CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: комментарий пуст"})
+		return
+	}
+	if body == comment.Body {
+		c.JSON(http.StatusOK, comment)
+		return
+	}
+
+	now := time.Now()
+	previous := comment.Body
+	previousMentions := comment.Mentions
+	comment.Body = body
+	comment.EditedAt = &now
+	comment.Mentions = resolveMentions(c, body)
+
+	err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		edit := TaskCommentEdit{CommentID: comment.ID, Body: previous, EditedBy: userID, EditedAt: now}
+		if err := tx.Create(&edit).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Mentions").Save(comment).Error; err != nil {
+			return err
+		}
+		// Mention rows belong to the comment by primary key, so they are
+		// replaced rather than detached.
+		if err := tx.Where("comment_id = ?", comment.ID).Delete(&CommentMention{}).Error; err != nil {
+			return err
+		}
+		if len(comment.Mentions) == 0 {
+			return nil
+		}
+		for i := range comment.Mentions {
+			comment.Mentions[i].CommentID = comment.ID
+		}
+		return tx.Create(&comment.Mentions).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления комментария"})
+		return
+	}
+
+	// Only users mentioned for the first time are notified about the edit.
+	if added := addedMentions(previousMentions, comment.Mentions); len(added) > 0 {
+		if data := commentEventData(c, task, comment, added); len(data.Mentions) > 0 {
+			publishCommentEvent(c, events.TaskCommentMentioned, data)
+		}
+	}
+
+	if comment.Mentions == nil {
+		comment.Mentions = []CommentMention{}
+	}
+	c.JSON(http.StatusOK, comment)
+}
+
+// deleteTaskComment serves DELETE /tasks/:id/comments/:comment_id.
+func deleteTaskComment(c *gin.Context) {
+	task, userID, role := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+	comment := loadComment(c, task)
+	if comment == nil {
+		return
+	}
+	if !canModifyComment(comment, userID, role) {
+		abortCommentForbidden(c, comment)
+		return
+	}
+
+	if err := db.WithContext(c).Delete(comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления комментария"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Комментарий удален"})
+}
+
+// getTaskCommentHistory serves GET /tasks/:id/comments/:comment_id/history:
+// the earlier versions of the comment, oldest first.
+func getTaskCommentHistory(c *gin.Context) {
+	task, _, _ := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+	comment := loadComment(c, task)
+	if comment == nil {
+		return
+	}
+
+	edits := []TaskCommentEdit{}
+	if err := db.WithContext(c).Where("comment_id = ?", comment.ID).Order("edited_at, id").Find(&edits).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки истории комментария"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"comment_id": comment.ID,
+		"body":       comment.Body,
+		"edits":      edits,
+	})
+}
+
+// commentEventData builds the payload of a comment event naming mentions
+// as the mentioned users. Users who may not see the task are left out, so
+// a mention does not leak the task to them.
+func commentEventData(c *gin.Context, task *Task, comment *TaskComment, mentions []CommentMention) events.CommentData {
+	data := events.CommentData{
+		CommentID:  comment.ID,
+		TaskID:     task.ID,
+		Title:      task.Title,
+		AuthorID:   comment.AuthorID,
+		AssignedTo: task.AssignedTo,
+		CreatedBy:  task.CreatedBy,
+		Excerpt:    excerpt(comment.Body),
+	}
+	for _, mention := range visibleMentions(c, task, mentions) {
+		data.Mentions = append(data.Mentions, mention.UserID)
+	}
+	return data
+}
+
+// visibleMentions keeps the mentions of users who may see task. When their
+// roles cannot be loaded nobody is notified.
+func visibleMentions(c *gin.Context, task *Task, mentions []CommentMention) []CommentMention {
+	if len(mentions) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(mentions))
+	for _, mention := range mentions {
+		ids = append(ids, mention.UserID)
+	}
+	roles, err := userRoles(c, ids)
+	if err != nil {
+		slog.WarnContext(c, "Failed to load roles of mentioned users", "task_id", task.ID, "error", err)
+		return nil
+	}
+	var visible []CommentMention
+	for _, mention := range mentions {
+		role, ok := roles[mention.UserID]
+		if ok && checkTaskPermissions(task, mention.UserID, role) {
+			visible = append(visible, mention)
+		}
+	}
+	return visible
+}
+
+func publishCommentEvent(c *gin.Context, eventType string, data events.CommentData) {
+	if err := publishEvent(c, eventType, data); err != nil {
+		slog.ErrorContext(c, "Failed to publish event", "event_type", eventType, "task_id", data.TaskID, "error", err)
+	}
+}
+
+// addedMentions returns the mentions in current that are not in previous.
+func addedMentions(previous, current []CommentMention) []CommentMention {
+	known := make(map[uint]bool, len(previous))
+	for _, mention := range previous {
+		known[mention.UserID] = true
+	}
+	var added []CommentMention
+	for _, mention := range current {
+		if !known[mention.UserID] {
+			added = append(added, mention)
+		}
+	}
+	return added
+}
+
+// excerpt shortens body for notifications.
+func excerpt(body string) string {
+	body = strings.Join(strings.Fields(body), " ")
+	if utf8.RuneCountInString(body) <= commentExcerptLen {
+		return body
+	}
+	runes := []rune(body)
+	return strings.TrimSpace(string(runes[:commentExcerptLen])) + "…"
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoadCommentRejectsMalformedID(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/tasks/1/comments/1%20OR%201=1", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "comment_id", Value: "1 OR 1=1"}}
+
+	if comment := loadComment(c, &Task{ID: 1}); comment != nil {
+		t.Fatalf("loadComment = %+v, want nil", comment)
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"no mentions here", nil},
+		{"@alice please look", []string{"alice"}},
+		{"cc @alice, @bob.", []string{"alice", "bob"}},
+		{"(@alice)", []string{"alice"}},
+		{"@alice,@bob", []string{"alice", "bob"}},
+		{"@john.doe and @jane-doe", []string{"john.doe", "jane-doe"}},
+		{"ask @bob...", []string{"bob"}},
+		{"@alice @Alice @alice", []string{"alice"}},
+		{"mail alice@example.com", nil},
+		{"@@alice", nil},
+		{"@ alone", nil},
+		{"@-dash", nil},
+		{"line\n@carol", []string{"carol"}},
+	}
+	for _, tt := range tests {
+		if got := parseMentions(tt.body); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMentions(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestParseMentionsLimit(t *testing.T) {
+	var body strings.Builder
+	for i := 0; i < maxCommentMentions+5; i++ {
+		fmt.Fprintf(&body, "@user%d ", i)
+	}
+	if got := parseMentions(body.String()); len(got) != maxCommentMentions {
+		t.Errorf("parsed %d mentions, want %d", len(got), maxCommentMentions)
+	}
+}
+
+func TestResolveMentionsFromUsersTable(t *testing.T) {
+	useTestDB(t)
+	if err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, role TEXT)").Error; err != nil {
+		t.Fatalf("create users: %v", err)
+	}
+	db.Exec("INSERT INTO users (id, username, role) VALUES (1, 'alice', 'user'), (2, 'bob', 'user')")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/tasks/1/comments", nil)
+	mentions := resolveMentions(c, "@bob and @nobody, see @alice")
+
+	got := make(map[uint]string)
+	for _, mention := range mentions {
+		got[mention.UserID] = mention.Username
+	}
+	if want := map[uint]string{1: "alice", 2: "bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mentions = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxGraphNodes caps how many tasks GET /tasks/:id/graph walks.
+const maxGraphNodes = 500
+
+// dependencyLockKey is the advisory lock that serializes changes to the
+// dependency graph and the subtask tree. A cycle can run through any tasks,
+// so two requests adding edges must not check the graph at the same time,
+// and a task must not be completed while a blocker is being added.
+const dependencyLockKey = 7230001
+
+var (
+	// errDependencyCycle means the new dependency would close a cycle.
+	errDependencyCycle = errors.New("dependency cycle")
+	// errSubtaskCycle means the new parent is the task or one of its
+	// subtasks.
+	errSubtaskCycle = errors.New("subtask cycle")
+)
+
+// openBlockersError refuses to complete a task that is still blocked.
+type openBlockersError struct {
+	blockers []uint
+}
+
+func (e *openBlockersError) Error() string {
+	return fmt.Sprintf("task has %d open blockers", len(e.blockers))
+}
+
+// TaskDependency says that TaskID cannot be completed before BlockedByID is
+// done: BlockedByID blocks TaskID.
+type TaskDependency struct {
+	TaskID      uint      `json:"task_id" gorm:"primaryKey;autoIncrement:false"`
+	BlockedByID uint      `json:"blocked_by_id" gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TaskRollup sums the hours of a task and all of its subtasks, recursively.
+type TaskRollup struct {
+	Subtasks       int64   `json:"subtasks"`
+	EstimatedHours float64 `json:"estimated_hours"`
+	ActualHours    float64 `json:"actual_hours"`
+}
+
+type DependencyRequest struct {
+	BlockedBy uint `json:"blocked_by" binding:"required"`
+}
+
+// taskRef is the short form of a task used in dependency lists and graphs.
+// Tasks the caller may not see keep only their ID and status.
+type taskRef struct {
+	ID       uint   `json:"id"`
+	Title    string `json:"title,omitempty"`
+	Status   string `json:"status"`
+	ParentID *uint  `json:"parent_id,omitempty"`
+	Hidden   bool   `json:"hidden,omitempty"`
+}
+
+type graphEdge struct {
+	From uint `json:"from"`
+	To   uint `json:"to"`
+}
+
+// isOpenTaskStatus reports whether a task in status still blocks others.
+func isOpenTaskStatus(status string) bool {
+	return status != taskStatusCompleted && status != taskStatusCancelled
+}
+
+// openBlockers returns the IDs of the unfinished tasks blocking taskID.
+func openBlockers(tx *gorm.DB, taskID uint) ([]uint, error) {
+	ids := []uint{}
+	err := tx.Model(&Task{}).
+		Joins("JOIN task_dependencies ON task_dependencies.blocked_by_id = tasks.id").
+		Where("task_dependencies.task_id = ?", taskID).
+		Where("tasks.status NOT IN ?", []string{taskStatusCompleted, taskStatusCancelled}).
+		Order("tasks.id").
+		Pluck("tasks.id", &ids).Error
+	return ids, err
+}
+
+func abortOpenBlockers(c *gin.Context, blockers []uint) {
+	c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+		"error":    "Задачу нельзя завершить, пока не завершены блокирующие ее задачи",
+		"code":     "open_blockers",
+		"blockers": blockers,
+	})
+}
+
+// dependsOn reports whether taskID is blocked by blockerID, directly or
+// through other tasks. Adding blockerID as a blocker of such a task would
+// close a cycle.
+func dependsOn(tx *gorm.DB, taskID, blockerID uint) (bool, error) {
+	var found int64
+	err := tx.Raw(`
+		WITH RECURSIVE blockers AS (
+			SELECT blocked_by_id AS id FROM task_dependencies WHERE task_id = ?
+			UNION
+			SELECT d.blocked_by_id FROM task_dependencies d JOIN blockers b ON d.task_id = b.id
+		)
+		SELECT COUNT(*) FROM blockers WHERE id = ?`, taskID, blockerID).Scan(&found).Error
+	return found > 0, err
+}
+
+// isAncestor reports whether ancestorID is taskID itself or one of its
+// parents, so making ancestorID a subtask of taskID would close a cycle.
+func isAncestor(tx *gorm.DB, ancestorID, taskID uint) (bool, error) {
+	var found int64
+	err := tx.Raw(`
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id FROM tasks WHERE id = ?
+			UNION
+			SELECT t.id, t.parent_id FROM tasks t JOIN chain ON t.id = chain.parent_id
+		)
+		SELECT COUNT(*) FROM chain WHERE id = ?`, taskID, ancestorID).Scan(&found).Error
+	return found > 0, err
+}
+
+// taskRollup sums the hours of task and its subtasks at any depth.
+func taskRollup(tx *gorm.DB, task *Task) (*TaskRollup, error) {
+	var rollup TaskRollup
+	err := tx.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT id, estimated_hours, actual_hours FROM tasks WHERE parent_id = ?
+			UNION
+			SELECT t.id, t.estimated_hours, t.actual_hours FROM tasks t JOIN subtree s ON t.parent_id = s.id
+		)
+		SELECT COUNT(*) AS subtasks,
+			COALESCE(SUM(estimated_hours), 0) AS estimated_hours,
+			COALESCE(SUM(actual_hours), 0) AS actual_hours
+		FROM subtree`, task.ID).Scan(&rollup).Error
+	if err != nil {
+		return nil, err
+	}
+	rollup.EstimatedHours += task.EstimatedHours
+	rollup.ActualHours += task.ActualHours
+	return &rollup, nil
+}
+
+// etagPart condenses the rollup for conditional.DerivedETag. A task
+// without subtasks has no rollup and keeps its plain version ETag.
+func (r *TaskRollup) etagPart() string {
+	if r == nil {
+		return ""
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d/%g/%g", r.Subtasks, r.EstimatedHours, r.ActualHours)
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+// lockDependencyGraph takes the graph lock for the rest of tx.
+func lockDependencyGraph(tx *gorm.DB) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", dependencyLockKey).Error
+}
+
+// checkTaskGraph checks, inside the transaction that saves task, the rules
+// that depend on other tasks: a new parent must not be one of the task's
+// subtasks, and a task may only be completed when nothing blocks it. It
+// holds the graph lock, so the checks stay true until tx commits.
+func checkTaskGraph(tx *gorm.DB, task, before *Task) error {
+	reparented := task.ParentID != nil && derefID(task.ParentID) != derefID(before.ParentID)
+	completed := task.Status == taskStatusCompleted && before.Status != taskStatusCompleted
+	if !reparented && !completed {
+		return nil
+	}
+	if err := lockDependencyGraph(tx); err != nil {
+		return err
+	}
+	if reparented {
+		cycle, err := isAncestor(tx, task.ID, *task.ParentID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return errSubtaskCycle
+		}
+	}
+	if completed {
+		blockers, err := openBlockers(tx, task.ID)
+		if err != nil {
+			return err
+		}
+		if len(blockers) > 0 {
+			return &openBlockersError{blockers: blockers}
+		}
+	}
+	return nil
+}
+
+// abortTaskGraph answers a write refused by checkTaskGraph and reports
+// whether err was such a refusal.
+func abortTaskGraph(c *gin.Context, err error) bool {
+	var blocked *openBlockersError
+	switch {
+	case errors.Is(err, errSubtaskCycle):
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Задача не может быть подзадачей самой себя или своей подзадачи",
+			"code":  "subtask_cycle",
+		})
+	case errors.As(err, &blocked):
+		abortOpenBlockers(c, blocked.blockers)
+	default:
+		return false
+	}
+	return true
+}
+
+// setTaskParent validates parentID as the new parent of task: the parent
+// must exist and be visible to the caller. Whether it is one of the task's
+// subtasks is checked by checkTaskGraph when the task is saved. It writes
+// the error response itself and returns false on failure. A zero parentID
+// detaches the task.
+func setTaskParent(c *gin.Context, task *Task, parentID uint, userID uint, role string) bool {
+	if parentID == 0 {
+		task.ParentID = nil
+		return true
+	}
+
+	var parent Task
+	if err := db.WithContext(c).First(&parent, parentID).Error; err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Родительская задача не найдена",
+			"code":  "invalid_parent",
+		})
+		return false
+	}
+	if !checkTaskPermissions(&parent, userID, role) {
+		abortForbidden(c, &parent)
+		return false
+	}
+	task.ParentID = &parent.ID
+	return true
+}
+
+// loadVisibleTask resolves :id and checks that the caller may see the task;
+// whoever may see a task may also read its dependencies and take part in
+// its discussion. It writes the error response itself and returns nil on
+// failure.
+func loadVisibleTask(c *gin.Context) (*Task, uint, string) {
+	userID, role, ok := currentUser(c)
+	if !ok {
+		abortUnauthenticated(c)
+		return nil, 0, ""
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор задачи"})
+		return nil, 0, ""
+	}
+
+	var task Task
+	if err := db.WithContext(c).First(&task, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+		return nil, 0, ""
+	}
+	if !checkTaskPermissions(&task, userID, role) {
+		abortForbidden(c, &task)
+		return nil, 0, ""
+	}
+	return &task, userID, role
+}
+
+// taskRefs loads the tasks with the given IDs in the short form, hiding
+// the titles of tasks the caller may not see.
+func taskRefs(c *gin.Context, ids []uint, userID uint, role string) ([]taskRef, error) {
+	refs := []taskRef{}
+	if len(ids) == 0 {
+		return refs, nil
+	}
+	var tasks []Task
+	if err := db.WithContext(c).Where("id IN ?", ids).Order("id").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		ref := taskRef{ID: task.ID, Status: task.Status, ParentID: task.ParentID}
+		if checkTaskPermissions(task, userID, role) {
+			ref.Title = task.Title
+		} else {
+			ref.Hidden = true
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// getSubtasks serves GET /tasks/:id/subtasks: the direct subtasks and the
+// hours rolled up over the whole subtree.
+func getSubtasks(c *gin.Context) {
+	task, userID, role := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+
+	subtasks := []Task{}
+	if err := visibleTasks(db.WithContext(c).Model(&Task{}), userID, role).
+		Where("parent_id = ?", task.ID).Order("id").Find(&subtasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки подзадач"})
+		return
+	}
+	rollup, err := taskRollup(db.WithContext(c), task)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка подсчета часов"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":  task.ID,
+		"subtasks": subtasks,
+		"rollup":   rollup,
+	})
+}
+
+// getTaskDependencies serves GET /tasks/:id/dependencies: the tasks
+// blocking this one and the tasks it blocks.
+func getTaskDependencies(c *gin.Context) {
+	task, userID, role := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+
+	var blockedBy, blocks []uint
+	if err := db.WithContext(c).Model(&TaskDependency{}).
+		Where("task_id = ?", task.ID).Pluck("blocked_by_id", &blockedBy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки зависимостей"})
+		return
+	}
+	if err := db.WithContext(c).Model(&TaskDependency{}).
+		Where("blocked_by_id = ?", task.ID).Pluck("task_id", &blocks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки зависимостей"})
+		return
+	}
+
+	blockedByRefs, err := taskRefs(c, blockedBy, userID, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки зависимостей"})
+		return
+	}
+	blocksRefs, err := taskRefs(c, blocks, userID, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки зависимостей"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":    task.ID,
+		"blocked_by": blockedByRefs,
+		"blocks":     blocksRefs,
+	})
+}
+
+// addTaskDependency serves POST /tasks/:id/dependencies: the task in
+// blocked_by starts blocking :id. Dependencies that would form a cycle are
+// refused.
+func addTaskDependency(c *gin.Context) {
+	task, userID, role := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+
+	var req DependencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+	var blocker Task
+	if err := db.WithContext(c).First(&blocker, req.BlockedBy).Error; err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Блокирующая задача не найдена",
+			"code":  "invalid_blocker",
+		})
+		return
+	}
+	if !checkTaskPermissions(&blocker, userID, role) {
+		abortForbidden(c, &blocker)
+		return
+	}
+
+	if blocker.ID == task.ID {
+		abortDependencyCycle(c, task.ID, blocker.ID)
+		return
+	}
+
+	dependency := TaskDependency{TaskID: task.ID, BlockedByID: blocker.ID, CreatedBy: userID, CreatedAt: time.Now()}
+	created := false
+	err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := lockDependencyGraph(tx); err != nil {
+			return err
+		}
+		cycle, err := dependsOn(tx, blocker.ID, task.ID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return errDependencyCycle
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dependency)
+		if result.Error != nil {
+			return result.Error
+		}
+		created = result.RowsAffected > 0
+		if !created {
+			// The dependency already exists; adding it again is not an error.
+			return tx.Where("task_id = ? AND blocked_by_id = ?", task.ID, blocker.ID).First(&dependency).Error
+		}
+		return nil
+	})
+	if errors.Is(err, errDependencyCycle) {
+		abortDependencyCycle(c, task.ID, blocker.ID)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка добавления зависимости"})
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, dependency)
+		return
+	}
+	c.JSON(http.StatusCreated, dependency)
+}
+
+func abortDependencyCycle(c *gin.Context, taskID, blockerID uint) {
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+		"error":      "Зависимость образует цикл",
+		"code":       "dependency_cycle",
+		"task_id":    taskID,
+		"blocked_by": blockerID,
+	})
+}
+
+// removeTaskDependency serves DELETE /tasks/:id/dependencies/:blocker_id.
+// It needs the same permissions as adding the dependency: both tasks must
+// be accessible to the caller.
+func removeTaskDependency(c *gin.Context) {
+	task, userID, role := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+	blockerID, err := strconv.ParseUint(c.Param("blocker_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор задачи"})
+		return
+	}
+	var blocker Task
+	if err := db.WithContext(c).First(&blocker, blockerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Зависимость не найдена"})
+		return
+	}
+	if !checkTaskPermissions(&blocker, userID, role) {
+		abortForbidden(c, &blocker)
+		return
+	}
+
+	result := db.WithContext(c).
+		Where("task_id = ? AND blocked_by_id = ?", task.ID, blocker.ID).
+		Delete(&TaskDependency{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления зависимости"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Зависимость не найдена"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Зависимость удалена"})
+}
+
+// getTaskGraph serves GET /tasks/:id/graph: every task that blocks :id,
+// directly or transitively, every task it blocks, and the edges between
+// them. An edge goes from the blocker to the blocked task.
+func getTaskGraph(c *gin.Context) {
+	task, userID, role := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+
+	nodes := map[uint]bool{task.ID: true}
+	edges := []graphEdge{}
+	truncated := false
+	for _, upstream := range []bool{true, false} {
+		found, walked, complete, err := walkDependencies(c, task.ID, upstream, maxGraphNodes-len(nodes)+1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка построения графа зависимостей"})
+			return
+		}
+		for id := range found {
+			nodes[id] = true
+		}
+		edges = append(edges, walked...)
+		truncated = truncated || !complete
+	}
+
+	ids := make([]uint, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	refs, err := taskRefs(c, ids, userID, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка построения графа зависимостей"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":   task.ID,
+		"nodes":     refs,
+		"edges":     edges,
+		"truncated": truncated,
+	})
+}
+
+// walkDependencies walks the dependency edges from start breadth first:
+// towards its blockers when upstream is set, towards the tasks it blocks
+// otherwise. It stops after limit tasks and then reports complete=false.
+func walkDependencies(c *gin.Context, start uint, upstream bool, limit int) (map[uint]bool, []graphEdge, bool, error) {
+	column := "task_id"
+	if !upstream {
+		column = "blocked_by_id"
+	}
+
+	seen := map[uint]bool{start: true}
+	edges := []graphEdge{}
+	frontier := []uint{start}
+	for len(frontier) > 0 {
+		var deps []TaskDependency
+		if err := db.WithContext(c).Where(column+" IN ?", frontier).
+			Order("task_id, blocked_by_id").Find(&deps).Error; err != nil {
+			return nil, nil, false, err
+		}
+
+		frontier = nil
+		for _, dep := range deps {
+			next := dep.BlockedByID
+			if !upstream {
+				next = dep.TaskID
+			}
+			if !seen[next] {
+				if len(seen) >= limit {
+					return seen, edges, false, nil
+				}
+				seen[next] = true
+				frontier = append(frontier, next)
+			}
+			edges = append(edges, graphEdge{From: dep.BlockedByID, To: dep.TaskID})
+		}
+	}
+	return seen, edges, true, nil
+}
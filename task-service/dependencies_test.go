@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlite3 with the PostgreSQL advisory lock as a no-op: the tests use a
+// single connection, so there is nothing to serialize.
+func init() {
+	sql.Register("sqlite3_advisory", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("pg_advisory_xact_lock", func(int64) int64 { return 0 }, true)
+		},
+	})
+}
+
+// useTestDB points db at a fresh in-memory SQLite database with the task
+// tables.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	testDB, err := gorm.Open(sqlite.New(sqlite.Config{DriverName: "sqlite3_advisory", DSN: ":memory:"}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	// Every connection to :memory: is a separate database.
+	sqlDB, err := testDB.DB()
+	if err != nil {
+		t.Fatalf("sqlite pool: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := testDB.AutoMigrate(&Task{}, &TaskDependency{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	previous := db
+	db = testDB
+	t.Cleanup(func() {
+		db = previous
+		sqlDB.Close()
+	})
+}
+
+// createTasks inserts tasks created by user 1 and returns them by title.
+func createTasks(t *testing.T, tasks ...Task) map[string]*Task {
+	t.Helper()
+	byTitle := make(map[string]*Task)
+	for i := range tasks {
+		task := &tasks[i]
+		if task.CreatedBy == 0 {
+			task.CreatedBy = 1
+		}
+		if task.Status == "" {
+			task.Status = taskStatusPending
+		}
+		if err := db.Create(task).Error; err != nil {
+			t.Fatalf("create task %s: %v", task.Title, err)
+		}
+		byTitle[task.Title] = task
+	}
+	return byTitle
+}
+
+func blockedBy(t *testing.T, task, blocker *Task) {
+	t.Helper()
+	if err := db.Create(&TaskDependency{TaskID: task.ID, BlockedByID: blocker.ID}).Error; err != nil {
+		t.Fatalf("add dependency: %v", err)
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	useTestDB(t)
+	tasks := createTasks(t, Task{Title: "a"}, Task{Title: "b"}, Task{Title: "c"}, Task{Title: "d"})
+	a, b, c, d := tasks["a"], tasks["b"], tasks["c"], tasks["d"]
+	// c blocks b, b blocks a.
+	blockedBy(t, a, b)
+	blockedBy(t, b, c)
+
+	tests := []struct {
+		name           string
+		task, blocker  *Task
+		wantTransitive bool
+	}{
+		{"direct", a, b, true},
+		{"transitive", a, c, true},
+		{"reverse", c, a, false},
+		{"unrelated", a, d, false},
+		{"itself", a, a, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dependsOn(db, tt.task.ID, tt.blocker.ID)
+			if err != nil {
+				t.Fatalf("dependsOn: %v", err)
+			}
+			if got != tt.wantTransitive {
+				t.Errorf("dependsOn(%s, %s) = %v, want %v", tt.task.Title, tt.blocker.Title, got, tt.wantTransitive)
+			}
+		})
+	}
+}
+
+func TestCheckTaskGraphSubtaskCycle(t *testing.T) {
+	useTestDB(t)
+	tasks := createTasks(t, Task{Title: "root"}, Task{Title: "other"})
+	root, other := tasks["root"], tasks["other"]
+	child := createTasks(t, Task{Title: "child", ParentID: &root.ID})["child"]
+	grandchild := createTasks(t, Task{Title: "grandchild", ParentID: &child.ID})["grandchild"]
+
+	tests := []struct {
+		name   string
+		task   *Task
+		parent *Task
+		want   error
+	}{
+		{"itself", root, root, errSubtaskCycle},
+		{"child", root, child, errSubtaskCycle},
+		{"grandchild", root, grandchild, errSubtaskCycle},
+		{"unrelated task", root, other, nil},
+		{"under a sibling subtree", other, grandchild, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := *tt.task
+			task := *tt.task
+			task.ParentID = &tt.parent.ID
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return checkTaskGraph(tx, &task, &before)
+			})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("moving %s under %s: err = %v, want %v", tt.task.Title, tt.parent.Title, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTaskGraphOpenBlockers(t *testing.T) {
+	useTestDB(t)
+	tasks := createTasks(t,
+		Task{Title: "task", Status: taskStatusReview},
+		Task{Title: "open"},
+		Task{Title: "done", Status: taskStatusCompleted},
+	)
+	task := tasks["task"]
+	blockedBy(t, task, tasks["done"])
+
+	complete := func() error {
+		before := *task
+		completed := *task
+		completed.Status = taskStatusCompleted
+		return db.Transaction(func(tx *gorm.DB) error {
+			return checkTaskGraph(tx, &completed, &before)
+		})
+	}
+	if err := complete(); err != nil {
+		t.Fatalf("completing with finished blockers: %v", err)
+	}
+
+	blockedBy(t, task, tasks["open"])
+	var blocked *openBlockersError
+	if err := complete(); !errors.As(err, &blocked) {
+		t.Fatalf("completing with an open blocker: err = %v, want openBlockersError", err)
+	}
+	if len(blocked.blockers) != 1 || blocked.blockers[0] != tasks["open"].ID {
+		t.Errorf("blockers = %v, want [%d]", blocked.blockers, tasks["open"].ID)
+	}
+}
+
+func TestRemoveTaskDependencyNeedsTheBlocker(t *testing.T) {
+	useTestDB(t)
+	// User 2 sees "mine" but not "theirs", which blocks it.
+	tasks := createTasks(t, Task{Title: "mine", CreatedBy: 2}, Task{Title: "theirs", CreatedBy: 3})
+	mine, theirs := tasks["mine"], tasks["theirs"]
+	blockedBy(t, mine, theirs)
+
+	r := gin.New()
+	r.DELETE("/tasks/:id/dependencies/:blocker_id", removeTaskDependency)
+	remove := func(userID string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/tasks/1/dependencies/2", nil)
+		req.Header.Set(headerUserID, userID)
+		req.Header.Set(headerUserRole, "user")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := remove("2"); code != http.StatusForbidden {
+		t.Errorf("removal without access to the blocker: status = %d, want 403", code)
+	}
+	var count int64
+	db.Model(&TaskDependency{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("dependency removed by a user who cannot see the blocker")
+	}
+	if code := remove("3"); code != http.StatusForbidden {
+		t.Errorf("removal without access to the task: status = %d, want 403", code)
+	}
+
+	db.Model(theirs).Update("assigned_to", 2)
+	if code := remove("2"); code != http.StatusOK {
+		t.Errorf("removal with access to both tasks: status = %d, want 200", code)
+	}
+}
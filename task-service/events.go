@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"shared/bootstrap"
+	"shared/events"
+)
+
+const eventSource = "task-service"
+
+var (
+	redisClient *redis.Client
+	publisher   events.Publisher = events.Nop{}
+)
+
+func initEvents(app *bootstrap.App) {
+	if !app.Config.Redis.Enabled() {
+		publisher = events.FromEnv(nil)
+		return
+	}
+	redisClient = app.OpenRedis()
+	publisher = events.FromEnv(redisClient)
+}
+
+func taskEventData(task *Task) events.TaskData {
+	data := events.TaskData{
+		TaskID:     task.ID,
+		Title:      task.Title,
+		ProjectID:  task.ProjectID,
+		AssignedTo: task.AssignedTo,
+		CreatedBy:  task.CreatedBy,
+		Status:     task.Status,
+		Priority:   task.Priority,
+	}
+	if !task.DueDate.IsZero() {
+		due := task.DueDate
+		data.DueDate = &due
+	}
+	return data
+}
+
+// publishTaskEvent is best effort: a failure to publish is logged but never
+// fails the request that caused it.
+func publishTaskEvent(c *gin.Context, eventType string, data events.TaskData) {
+	if err := publishEvent(c, eventType, data); err != nil {
+		slog.ErrorContext(c, "Failed to publish event", "event_type", eventType, "task_id", data.TaskID, "error", err)
+	}
+}
+
+// publishEvent wraps data in an envelope attributed to the caller.
+func publishEvent(c *gin.Context, eventType string, data interface{}) error {
+	actorID, _, _ := currentUser(c)
+	event, err := events.New(eventType, eventSource, actorID, data)
+	if err != nil {
+		return err
+	}
+	return publisher.Publish(c, event)
+}
+
+// publishTaskChanges emits task.updated plus the more specific events for
+// whatever changed between before and after. A nil before means the task
+// was just created.
+func publishTaskChanges(c *gin.Context, before, after *Task) {
+	if before == nil {
+		publishTaskEvent(c, events.TaskCreated, taskEventData(after))
+		if after.AssignedTo != 0 {
+			publishTaskEvent(c, events.TaskAssigned, taskEventData(after))
+		}
+		return
+	}
+
+	publishTaskEvent(c, events.TaskUpdated, taskEventData(after))
+
+	if before.AssignedTo != after.AssignedTo && after.AssignedTo != 0 {
+		data := taskEventData(after)
+		data.PreviousAssignee = before.AssignedTo
+		publishTaskEvent(c, events.TaskAssigned, data)
+	}
+	if before.Status != after.Status {
+		data := taskEventData(after)
+		data.PreviousStatus = before.Status
+		publishTaskEvent(c, events.TaskStatusChanged, data)
+	}
+}
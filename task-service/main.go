@@ -1,15 +1,16 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"shared/bootstrap"
+	"shared/conditional"
+	"shared/events"
+	"shared/logging"
 )
 
 type Task struct {
@@ -17,6 +18,7 @@ type Task struct {
 	Title          string    `json:"title"`
 	Description    string    `json:"description"`
 	ProjectID      uint      `json:"project_id"`
+	ParentID       *uint     `json:"parent_id,omitempty" gorm:"index"`
 	AssignedTo     uint      `json:"assigned_to"`
 	Status         string    `json:"status"`
 	Priority       string    `json:"priority"`
@@ -26,109 +28,152 @@ type Task struct {
 	CreatedBy      uint      `json:"created_by"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
+	Version        int64     `json:"version" gorm:"not null;default:1"`
+
+	// Rollup is filled in by GET /tasks/:id for tasks with subtasks.
+	Rollup *TaskRollup `json:"rollup,omitempty" gorm:"-"`
 }
 
 type TaskCreateRequest struct {
 	Title          string    `json:"title" binding:"required"`
 	Description    string    `json:"description"`
-	ProjectID      uint      `json:"project_id"`
-	AssignedTo     uint      `json:"assigned_to"`
+	ProjectID      *uint     `json:"project_id"`
+	ParentID       *uint     `json:"parent_id"`
+	AssignedTo     *uint     `json:"assigned_to"`
 	Status         string    `json:"status"`
 	Priority       string    `json:"priority"`
 	DueDate        time.Time `json:"due_date"`
 	EstimatedHours float64   `json:"estimated_hours"`
 	ActualHours    float64   `json:"actual_hours"`
-	CreatedBy      uint      `json:"created_by"`
 }
 
 var db *gorm.DB
 
 func main() {
-	initDB()
-
-	r := gin.Default()
-
-	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		var dbStatus string
-		if db != nil {
-			sqlDB, err := db.DB()
-			if err == nil {
-				err = sqlDB.Ping()
-				if err == nil {
-					dbStatus = "OK"
-				} else {
-					dbStatus = "ERROR"
-				}
-			} else {
-				dbStatus = "ERROR"
-			}
-		} else {
-			dbStatus = "ERROR"
-		}
+	app := bootstrap.New("task-service", "8082")
 
-		c.JSON(http.StatusOK, gin.H{
-			"status":    "Task Service OK",
-			"database":  dbStatus,
-			"timestamp": time.Now().Format(time.RFC3339),
-		})
-	})
+	initDB(app)
+	initEvents(app)
+
+	r := app.Router
+	app.RegisterHealth("Task Service OK", nil)
 
 	// Task routes
 	r.GET("/tasks", getTasks)
 	r.GET("/tasks/:id", getTask)
+	r.GET("/tasks/:id/history", getTaskHistory)
+	r.GET("/tasks/:id/subtasks", getSubtasks)
+	r.GET("/tasks/:id/dependencies", getTaskDependencies)
+	r.POST("/tasks/:id/dependencies", addTaskDependency)
+	r.DELETE("/tasks/:id/dependencies/:blocker_id", removeTaskDependency)
+	r.GET("/tasks/:id/graph", getTaskGraph)
+	r.GET("/tasks/:id/comments", getTaskComments)
+	r.POST("/tasks/:id/comments", createTaskComment)
+	r.PUT("/tasks/:id/comments/:comment_id", updateTaskComment)
+	r.DELETE("/tasks/:id/comments/:comment_id", deleteTaskComment)
+	r.GET("/tasks/:id/comments/:comment_id/history", getTaskCommentHistory)
 	r.POST("/tasks", createTask)
 	r.PUT("/tasks/:id", updateTask)
+	r.PATCH("/tasks/:id", patchTask)
 	r.DELETE("/tasks/:id", deleteTask)
 	r.GET("/tasks/stats", getTaskStats)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8082"
-	}
-
-	log.Printf("Task service running on port %s", port)
-	log.Fatal(r.Run(":" + port))
+	// Project routes
+	r.GET("/projects", getProjects)
+	r.GET("/projects/:id", getProject)
+	r.POST("/projects", createProject)
+	r.PUT("/projects/:id", updateProject)
+	r.PUT("/projects/:id/status", updateProjectStatus)
+	r.DELETE("/projects/:id", deleteProject)
+	r.GET("/projects/:id/members", getProjectMembers)
+	r.POST("/projects/:id/members", addProjectMember)
+	r.PUT("/projects/:id/members/:user_id", updateProjectMember)
+	r.DELETE("/projects/:id/members/:user_id", removeProjectMember)
+
+	app.Run()
 }
 
-func initDB() {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"), os.Getenv("DB_PORT"))
-
+func initDB(app *bootstrap.App) {
 	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err = app.OpenDB()
 	if err != nil {
-		log.Printf("Failed to connect to database: %v", err)
-	} else {
-		log.Println("Successfully connected to database")
-		db.AutoMigrate(&Task{})
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
+	db.AutoMigrate(&Task{}, &Project{}, &ProjectMember{}, &TaskStatusHistory{}, &TaskDependency{},
+		&TaskComment{}, &CommentMention{}, &TaskCommentEdit{})
 }
 
 func getTasks(c *gin.Context) {
-	var tasks []Task
-	if db != nil {
-		db.Find(&tasks)
+	userID, role, ok := currentUser(c)
+	if !ok {
+		abortUnauthenticated(c)
+		return
 	}
-	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
-}
 
-func getTask(c *gin.Context) {
-	id := c.Param("id")
-	var task Task
+	params, err := parseTaskListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные параметры: " + err.Error()})
+		return
+	}
 
+	tasks := []Task{}
+	response := gin.H{"limit": params.limit, "sort": params.sortName}
 	if db != nil {
-		result := db.First(&task, id)
-		if result.Error != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+		if params.includeTotal {
+			var total int64
+			params.filter(visibleTasks(db.WithContext(c).Model(&Task{}), userID, role)).Count(&total)
+			response["total"] = total
+		}
+
+		query, err := params.paginate(params.filter(visibleTasks(db.WithContext(c).Model(&Task{}), userID, role)))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный cursor"})
+			return
+		}
+		if err := query.Find(&tasks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки задач"})
 			return
 		}
+
+		var next, prev string
+		tasks, next, prev = params.page(tasks)
+		response["next_cursor"] = next
+		response["prev_cursor"] = prev
+	}
+	response["tasks"] = tasks
+	c.JSON(http.StatusOK, response)
+}
+
+func getTask(c *gin.Context) {
+	task, _, _ := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+	rollup, err := taskRollup(db.WithContext(c), task)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка подсчета часов"})
+		return
+	}
+	if rollup.Subtasks > 0 {
+		task.Rollup = rollup
+	}
+	// Subtask changes do not bump the task's version but change the rollup,
+	// so the rollup is part of the ETag.
+	if conditional.NotModifiedETag(c, conditional.DerivedETag(task.Version, task.Rollup.etagPart())) {
+		return
 	}
 	c.JSON(http.StatusOK, task)
 }
 
+// createTask records the caller as the task's author; a created_by in the
+// body is ignored.
 func createTask(c *gin.Context) {
+	actorID, role, ok := currentUser(c)
+	if !ok {
+		abortUnauthenticated(c)
+		return
+	}
+
 	var req TaskCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
@@ -138,101 +183,227 @@ func createTask(c *gin.Context) {
 	task := Task{
 		Title:          req.Title,
 		Description:    req.Description,
-		ProjectID:      req.ProjectID,
-		AssignedTo:     req.AssignedTo,
+		ProjectID:      derefID(req.ProjectID),
+		AssignedTo:     derefID(req.AssignedTo),
 		Status:         req.Status,
 		Priority:       req.Priority,
 		DueDate:        req.DueDate,
 		EstimatedHours: req.EstimatedHours,
 		ActualHours:    req.ActualHours,
-		CreatedBy:      req.CreatedBy,
+		CreatedBy:      actorID,
 	}
 
 	if task.Status == "" {
-		task.Status = "pending"
+		task.Status = taskStatusPending
+	}
+	if !isInitialTaskStatus(task.Status) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Недопустимый начальный статус задачи",
+			"code":    "invalid_status",
+			"status":  task.Status,
+			"allowed": initialTaskStatuses,
+		})
+		return
 	}
 	if task.Priority == "" {
 		task.Priority = "medium"
 	}
+	if db != nil && !checkTaskReferences(c, &Task{}, task.ProjectID, task.AssignedTo, actorID, role) {
+		return
+	}
+	if req.ParentID != nil && db != nil && !setTaskParent(c, &task, *req.ParentID, actorID, role) {
+		return
+	}
 
 	task.CreatedAt = time.Now()
 	task.UpdatedAt = time.Now()
+	task.Version = 1
 
 	if db != nil {
-		result := db.Create(&task)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания задачи: " + result.Error.Error()})
+		err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+			if err := createTaskRow(tx, &task); err != nil {
+				return err
+			}
+			return recordStatusChange(tx, &task, "", actorID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания задачи: " + err.Error()})
 			return
 		}
+		publishTaskChanges(c, nil, &task)
 	}
 
+	conditional.SetETag(c, task.Version)
 	c.JSON(http.StatusCreated, task)
 }
 
 func updateTask(c *gin.Context) {
-	id := c.Param("id")
-	var task Task
+	task, userID, role := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+	if err := conditional.CheckIfMatch(c, task.Version); err != nil {
+		abortPrecondition(c, err, task)
+		return
+	}
 
-	if db != nil {
-		result := db.First(&task, id)
-		if result.Error != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
-			return
-		}
+	var updateData TaskCreateRequest
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
 
-		var updateData TaskCreateRequest
-		if err := c.ShouldBindJSON(&updateData); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
-			return
-		}
+	// An omitted status leaves the task where it is in the workflow.
+	if updateData.Status != "" && updateData.Status != task.Status &&
+		!canTransitionTask(task.Status, updateData.Status) {
+		abortInvalidTransition(c, task.Status, updateData.Status)
+		return
+	}
+	// An omitted project_id or assigned_to keeps the current one, 0 clears it.
+	projectID, assignee := task.ProjectID, task.AssignedTo
+	if updateData.ProjectID != nil {
+		projectID = *updateData.ProjectID
+	}
+	if updateData.AssignedTo != nil {
+		assignee = *updateData.AssignedTo
+	}
+	if !checkTaskReferences(c, task, projectID, assignee, userID, role) {
+		return
+	}
 
-		task.Title = updateData.Title
-		task.Description = updateData.Description
+	before := *task
+	// An omitted parent_id keeps the parent, 0 detaches the task.
+	if updateData.ParentID != nil && !setTaskParent(c, task, *updateData.ParentID, userID, role) {
+		return
+	}
+	task.Title = updateData.Title
+	task.ProjectID = projectID
+	task.AssignedTo = assignee
+	task.Description = updateData.Description
+	if updateData.Status != "" {
 		task.Status = updateData.Status
-		task.Priority = updateData.Priority
-		task.DueDate = updateData.DueDate
-		task.EstimatedHours = updateData.EstimatedHours
-		task.ActualHours = updateData.ActualHours
-		task.UpdatedAt = time.Now()
+	}
+	task.Priority = updateData.Priority
+	task.DueDate = updateData.DueDate
+	task.EstimatedHours = updateData.EstimatedHours
+	task.ActualHours = updateData.ActualHours
+	task.UpdatedAt = time.Now()
 
-		db.Save(&task)
+	err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := checkTaskGraph(tx, task, &before); err != nil {
+			return err
+		}
+		if err := saveTaskVersion(tx, task, taskPutColumns); err != nil {
+			return err
+		}
+		return recordStatusChange(tx, task, before.Status, userID)
+	})
+	if errors.Is(err, errVersionConflict) {
+		abortPrecondition(c, err, task)
+		return
+	}
+	if abortTaskGraph(c, err) {
+		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления задачи"})
+		return
+	}
+	publishTaskChanges(c, &before, task)
 
+	conditional.SetETag(c, task.Version)
 	c.JSON(http.StatusOK, task)
 }
 
 func deleteTask(c *gin.Context) {
-	id := c.Param("id")
+	task, _, _ := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+	if err := conditional.CheckIfMatch(c, task.Version); err != nil {
+		abortPrecondition(c, err, task)
+		return
+	}
 
-	if db != nil {
-		result := db.Delete(&Task{}, id)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления задачи"})
-			return
+	// Subtasks outlive their parent as top-level tasks; dependencies on
+	// the task go away with it.
+	err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		detach := map[string]interface{}{"parent_id": nil, "version": gorm.Expr("version + 1")}
+		if err := tx.Model(&Task{}).Where("parent_id = ?", task.ID).Updates(detach).Error; err != nil {
+			return err
 		}
-		if result.RowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
-			return
+		if err := tx.Where("task_id = ? OR blocked_by_id = ?", task.ID, task.ID).Delete(&TaskDependency{}).Error; err != nil {
+			return err
 		}
+		result := tx.Where("version = ?", task.Version).Delete(task)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		return result.Error
+	})
+	if errors.Is(err, errVersionConflict) {
+		abortPrecondition(c, err, task)
+		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления задачи"})
+		return
+	}
+	publishTaskEvent(c, events.TaskDeleted, taskEventData(task))
 
 	c.JSON(http.StatusOK, gin.H{"message": "Задача успешно удалена"})
 }
 
-func checkTaskPermissions(c *gin.Context, task *Task, currentUserID uint, currentUserRole string) bool {
+func checkTaskPermissions(task *Task, currentUserID uint, currentUserRole string) bool {
 	if currentUserRole == "admin" {
 		return true
 	}
-	if currentUserRole == "manager" {
-		return task.AssignedTo == currentUserID || task.CreatedBy == currentUserID
+	if task.AssignedTo == currentUserID || task.CreatedBy == currentUserID {
+		return true
+	}
+	return managesProject(task.ProjectID, currentUserID)
+}
+
+// checkTaskReferences validates the project and assignee a write gives task.
+// A changed project must exist and be visible to the caller, a changed
+// assignee must exist; zero clears the reference and is always allowed. It
+// writes the error response itself.
+func checkTaskReferences(c *gin.Context, task *Task, projectID, assignee, userID uint, role string) bool {
+	if projectID != task.ProjectID && projectID != 0 {
+		var project Project
+		if err := db.WithContext(c).First(&project, projectID).Error; err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "Проект не найден",
+				"code":  "invalid_project",
+			})
+			return false
+		}
+		if !canViewProject(&project, userID, role) {
+			abortProjectForbidden(c, &project)
+			return false
+		}
+	}
+	if assignee != task.AssignedTo && assignee != 0 {
+		exists, err := userExists(c, assignee)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки исполнителя"})
+			return false
+		}
+		if !exists {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "Исполнитель не найден",
+				"code":  "invalid_assignee",
+			})
+			return false
+		}
 	}
-	return task.AssignedTo == currentUserID || task.CreatedBy == currentUserID
+	return true
 }
 
 func getTaskStats(c *gin.Context) {
 	var total int64
 	if db != nil {
-		db.Model(&Task{}).Count(&total)
+		db.WithContext(c).Model(&Task{}).Count(&total)
 	}
 	c.JSON(http.StatusOK, gin.H{"total_tasks": total})
 }
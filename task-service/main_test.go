@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestTaskHandlersRejectMalformedIDs(t *testing.T) {
+	r := gin.New()
+	r.GET("/tasks/:id", getTask)
+	r.PUT("/tasks/:id", updateTask)
+	r.DELETE("/tasks/:id", deleteTask)
+
+	// A non-numeric id must never reach the query: GORM would treat it as
+	// a raw SQL condition.
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		for _, id := range []string{"1%20OR%201=1", "abc", "-1"} {
+			req := httptest.NewRequest(method, "/tasks/"+id, nil)
+			req.Header.Set(headerUserID, "1")
+			req.Header.Set(headerUserRole, "user")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s /tasks/%s: status = %d, want 400", method, id, w.Code)
+			}
+		}
+	}
+}
+
+func TestCreateTaskRequiresIdentity(t *testing.T) {
+	r := gin.New()
+	r.POST("/tasks", createTask)
+
+	// created_by in the body must not stand in for the caller's identity.
+	body := strings.NewReader(`{"title": "t", "created_by": 1}`)
+	req := httptest.NewRequest(http.MethodPost, "/tasks", body)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shared/conditional"
+	"shared/mergepatch"
+)
+
+// TaskPatch lists the task fields PATCH /tasks/:id may change. Its JSON
+// names are also the column names, so the patched fields are the columns
+// to update. The references are pointers so that null clears them.
+type TaskPatch struct {
+	Title          string     `json:"title" binding:"required,max=200"`
+	Description    string     `json:"description"`
+	ProjectID      *uint      `json:"project_id"`
+	ParentID       *uint      `json:"parent_id"`
+	AssignedTo     *uint      `json:"assigned_to"`
+	Status         string     `json:"status" binding:"required"`
+	Priority       string     `json:"priority" binding:"required,oneof=low medium high urgent"`
+	DueDate        *time.Time `json:"due_date"`
+	EstimatedHours float64    `json:"estimated_hours" binding:"min=0"`
+	ActualHours    float64    `json:"actual_hours" binding:"min=0"`
+}
+
+func newTaskPatch(task *Task) TaskPatch {
+	patch := TaskPatch{
+		Title:          task.Title,
+		Description:    task.Description,
+		ProjectID:      optionalID(task.ProjectID),
+		ParentID:       task.ParentID,
+		AssignedTo:     optionalID(task.AssignedTo),
+		Status:         task.Status,
+		Priority:       task.Priority,
+		EstimatedHours: task.EstimatedHours,
+		ActualHours:    task.ActualHours,
+	}
+	if !task.DueDate.IsZero() {
+		due := task.DueDate
+		patch.DueDate = &due
+	}
+	return patch
+}
+
+// patchTask serves PATCH /tasks/:id. The body is a JSON Merge Patch: only
+// the fields it names change, null clears a field. Status changes follow
+// the workflow like PUT does.
+func patchTask(c *gin.Context) {
+	task, userID, role := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+	if err := conditional.CheckIfMatch(c, task.Version); err != nil {
+		abortPrecondition(c, err, task)
+		return
+	}
+
+	patch := newTaskPatch(task)
+	fields, err := mergepatch.Bind(c, &patch)
+	if err != nil {
+		mergepatch.Abort(c, err)
+		return
+	}
+	if len(fields) == 0 {
+		conditional.SetETag(c, task.Version)
+		c.JSON(http.StatusOK, task)
+		return
+	}
+
+	if patch.Status != task.Status && !canTransitionTask(task.Status, patch.Status) {
+		abortInvalidTransition(c, task.Status, patch.Status)
+		return
+	}
+	if !checkTaskReferences(c, task, derefID(patch.ProjectID), derefID(patch.AssignedTo), userID, role) {
+		return
+	}
+
+	before := *task
+	if derefID(patch.ParentID) != derefID(task.ParentID) &&
+		!setTaskParent(c, task, derefID(patch.ParentID), userID, role) {
+		return
+	}
+	task.Title = patch.Title
+	task.Description = patch.Description
+	task.ProjectID = derefID(patch.ProjectID)
+	task.AssignedTo = derefID(patch.AssignedTo)
+	task.Status = patch.Status
+	task.Priority = patch.Priority
+	task.DueDate = time.Time{}
+	if patch.DueDate != nil {
+		task.DueDate = *patch.DueDate
+	}
+	task.EstimatedHours = patch.EstimatedHours
+	task.ActualHours = patch.ActualHours
+	task.UpdatedAt = time.Now()
+
+	err = db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := checkTaskGraph(tx, task, &before); err != nil {
+			return err
+		}
+		if err := saveTaskVersion(tx, task, append(fields, "updated_at")); err != nil {
+			return err
+		}
+		return recordStatusChange(tx, task, before.Status, userID)
+	})
+	if errors.Is(err, errVersionConflict) {
+		abortPrecondition(c, err, task)
+		return
+	}
+	if abortTaskGraph(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления задачи"})
+		return
+	}
+	publishTaskChanges(c, &before, task)
+
+	conditional.SetETag(c, task.Version)
+	c.JSON(http.StatusOK, task)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"shared/mergepatch"
+)
+
+// patchAs sends a merge patch for task 1 as user 1 and reloads the task.
+func patchAs(t *testing.T, body string) (*httptest.ResponseRecorder, Task) {
+	t.Helper()
+	r := gin.New()
+	r.PATCH("/tasks/:id", patchTask)
+	req := httptest.NewRequest(http.MethodPatch, "/tasks/1", strings.NewReader(body))
+	req.Header.Set("Content-Type", mergepatch.ContentType)
+	req.Header.Set(headerUserID, "1")
+	req.Header.Set(headerUserRole, "user")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var task Task
+	if err := db.First(&task, 1).Error; err != nil {
+		t.Fatalf("reload task: %v", err)
+	}
+	return w, task
+}
+
+func TestPatchTaskAbsentAndNull(t *testing.T) {
+	useTestDB(t)
+	if err := db.AutoMigrate(&TaskStatusHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, role TEXT)").Error; err != nil {
+		t.Fatalf("create users: %v", err)
+	}
+	db.Exec("INSERT INTO users (id, role) VALUES (1, 'user'), (2, 'user')")
+
+	due := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	createTasks(t, Task{
+		Title:          "Write tests",
+		Description:    "for PATCH",
+		AssignedTo:     2,
+		Priority:       "high",
+		DueDate:        due,
+		EstimatedHours: 3,
+		Version:        1,
+	})
+
+	// Absent fields keep their values.
+	w, task := patchAs(t, `{"title":"Write more tests"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch title: status = %d (body %s)", w.Code, w.Body)
+	}
+	if task.Title != "Write more tests" || task.Description != "for PATCH" || task.AssignedTo != 2 ||
+		!task.DueDate.Equal(due) || task.EstimatedHours != 3 || task.Priority != "high" {
+		t.Errorf("absent fields changed: %+v", task)
+	}
+	if task.Version != 2 {
+		t.Errorf("version = %d, want 2", task.Version)
+	}
+
+	// Null clears them.
+	w, task = patchAs(t, `{"description":null,"assigned_to":null,"due_date":null}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch nulls: status = %d (body %s)", w.Code, w.Body)
+	}
+	if task.Description != "" || task.AssignedTo != 0 || !task.DueDate.IsZero() {
+		t.Errorf("null did not clear: description %q, assigned_to %d, due_date %v",
+			task.Description, task.AssignedTo, task.DueDate)
+	}
+	if task.Title != "Write more tests" || task.EstimatedHours != 3 {
+		t.Errorf("fields not in the patch changed: %+v", task)
+	}
+	var nulls int64
+	db.Model(&Task{}).Where("assigned_to IS NULL AND due_date IS NULL").Count(&nulls)
+	if nulls != 1 {
+		t.Error("cleared references were not stored as NULL")
+	}
+
+	// Required fields cannot be cleared.
+	w, task = patchAs(t, `{"title":null}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("clearing the title: status = %d, want 400", w.Code)
+	}
+	var resp struct {
+		Fields map[string]string `json:"fields"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Fields["title"] != "required" {
+		t.Errorf("fields = %v, want title: required", resp.Fields)
+	}
+	if task.Title != "Write more tests" {
+		t.Errorf("refused patch changed the title to %q", task.Title)
+	}
+
+	// An empty patch changes nothing, not even the version.
+	w, task = patchAs(t, `{}`)
+	if w.Code != http.StatusOK || task.Version != 3 {
+		t.Errorf("empty patch: status %d, version %d; want 200 and version 3", w.Code, task.Version)
+	}
+}
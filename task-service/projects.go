@@ -0,0 +1,441 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type Project struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"not null"`
+	Description string    `json:"description"`
+	OwnerID     uint      `json:"owner_id"`
+	Status      string    `json:"status" gorm:"default:active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ProjectMember struct {
+	ProjectID uint      `json:"project_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ProjectCreateRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+type ProjectStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+type ProjectMemberRequest struct {
+	UserID uint   `json:"user_id"`
+	Role   string `json:"role" binding:"required"`
+}
+
+// Per-project roles. The owner role is granted to the project creator and
+// moves with owner_id; it cannot be assigned through the members endpoints.
+const (
+	projectRoleOwner   = "owner"
+	projectRoleManager = "manager"
+	projectRoleMember  = "member"
+	projectRoleViewer  = "viewer"
+)
+
+var assignableProjectRoles = map[string]bool{
+	projectRoleManager: true,
+	projectRoleMember:  true,
+	projectRoleViewer:  true,
+}
+
+// projectTransitions lists the allowed status changes for a project.
+var projectTransitions = map[string][]string{
+	"active":    {"archived", "completed"},
+	"completed": {"active", "archived"},
+	"archived":  {"active"},
+}
+
+func canTransitionProject(from, to string) bool {
+	for _, allowed := range projectTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// projectRole returns the caller's role in the project, or "" if the caller
+// is not a member.
+func projectRole(project *Project, userID uint) string {
+	if project.OwnerID == userID {
+		return projectRoleOwner
+	}
+	var member ProjectMember
+	if err := db.Where("project_id = ? AND user_id = ?", project.ID, userID).First(&member).Error; err != nil {
+		return ""
+	}
+	return member.Role
+}
+
+func canViewProject(project *Project, userID uint, role string) bool {
+	return role == "admin" || projectRole(project, userID) != ""
+}
+
+func canManageProject(project *Project, userID uint, role string) bool {
+	if role == "admin" {
+		return true
+	}
+	projectRole := projectRole(project, userID)
+	return projectRole == projectRoleOwner || projectRole == projectRoleManager
+}
+
+func abortProjectForbidden(c *gin.Context, project *Project) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":      "Недостаточно прав для доступа к проекту",
+		"code":       "forbidden",
+		"project_id": project.ID,
+	})
+}
+
+// loadProject resolves :id and checks that the caller may see the project.
+// It writes the error response itself and returns nil on failure.
+func loadProject(c *gin.Context) (*Project, uint, string) {
+	userID, role, ok := currentUser(c)
+	if !ok {
+		abortUnauthenticated(c)
+		return nil, 0, ""
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор проекта"})
+		return nil, 0, ""
+	}
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "База данных недоступна"})
+		return nil, 0, ""
+	}
+
+	var project Project
+	if err := db.WithContext(c).First(&project, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Проект не найден"})
+		return nil, 0, ""
+	}
+	if !canViewProject(&project, userID, role) {
+		abortProjectForbidden(c, &project)
+		return nil, 0, ""
+	}
+	return &project, userID, role
+}
+
+func getProjects(c *gin.Context) {
+	userID, role, ok := currentUser(c)
+	if !ok {
+		abortUnauthenticated(c)
+		return
+	}
+
+	var projects []Project
+	if db != nil {
+		query := db.WithContext(c).Order("id")
+		if role != "admin" {
+			query = query.Where("owner_id = ? OR id IN (?)", userID,
+				db.WithContext(c).Model(&ProjectMember{}).Select("project_id").Where("user_id = ?", userID))
+		}
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		query.Find(&projects)
+	}
+	c.JSON(http.StatusOK, gin.H{"projects": projects})
+}
+
+func getProject(c *gin.Context) {
+	project, _, _ := loadProject(c)
+	if project == nil {
+		return
+	}
+	c.JSON(http.StatusOK, project)
+}
+
+func createProject(c *gin.Context) {
+	userID, role, ok := currentUser(c)
+	if !ok {
+		abortUnauthenticated(c)
+		return
+	}
+	if role != "admin" && role != "manager" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Только администратор или менеджер может создавать проекты", "code": "forbidden"})
+		return
+	}
+
+	var req ProjectCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+
+	project := Project{
+		Name:        req.Name,
+		Description: req.Description,
+		OwnerID:     userID,
+		Status:      "active",
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	if db != nil {
+		err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&project).Error; err != nil {
+				return err
+			}
+			return tx.Create(&ProjectMember{
+				ProjectID: project.ID,
+				UserID:    userID,
+				Role:      projectRoleOwner,
+				CreatedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания проекта: " + err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, project)
+}
+
+func updateProject(c *gin.Context) {
+	project, userID, role := loadProject(c)
+	if project == nil {
+		return
+	}
+	if !canManageProject(project, userID, role) {
+		abortProjectForbidden(c, project)
+		return
+	}
+
+	var req ProjectCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+
+	project.Name = req.Name
+	project.Description = req.Description
+	project.UpdatedAt = time.Now()
+	if err := db.WithContext(c).Save(project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления проекта"})
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+func updateProjectStatus(c *gin.Context) {
+	project, userID, role := loadProject(c)
+	if project == nil {
+		return
+	}
+	if !canManageProject(project, userID, role) {
+		abortProjectForbidden(c, project)
+		return
+	}
+
+	var req ProjectStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+	if !canTransitionProject(project.Status, req.Status) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Недопустимая смена статуса проекта",
+			"code":    "invalid_transition",
+			"from":    project.Status,
+			"to":      req.Status,
+			"allowed": projectTransitions[project.Status],
+		})
+		return
+	}
+
+	project.Status = req.Status
+	project.UpdatedAt = time.Now()
+	if err := db.WithContext(c).Save(project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка смены статуса проекта"})
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+func deleteProject(c *gin.Context) {
+	project, userID, role := loadProject(c)
+	if project == nil {
+		return
+	}
+	if role != "admin" && project.OwnerID != userID {
+		abortProjectForbidden(c, project)
+		return
+	}
+
+	var taskCount int64
+	db.WithContext(c).Model(&Task{}).Where("project_id = ?", project.ID).Count(&taskCount)
+	if taskCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "В проекте есть задачи; архивируйте проект вместо удаления",
+			"code":       "project_not_empty",
+			"task_count": taskCount,
+		})
+		return
+	}
+
+	err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ?", project.ID).Delete(&ProjectMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(project).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления проекта"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Проект успешно удален"})
+}
+
+func getProjectMembers(c *gin.Context) {
+	project, _, _ := loadProject(c)
+	if project == nil {
+		return
+	}
+
+	var members []ProjectMember
+	db.WithContext(c).Where("project_id = ?", project.ID).Order("created_at").Find(&members)
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+func addProjectMember(c *gin.Context) {
+	project, userID, role := loadProject(c)
+	if project == nil {
+		return
+	}
+	if !canManageProject(project, userID, role) {
+		abortProjectForbidden(c, project)
+		return
+	}
+
+	var req ProjectMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+	if req.UserID == 0 || !assignableProjectRoles[req.Role] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: укажите user_id и роль manager, member или viewer"})
+		return
+	}
+
+	var existing int64
+	db.WithContext(c).Model(&ProjectMember{}).Where("project_id = ? AND user_id = ?", project.ID, req.UserID).Count(&existing)
+	if existing > 0 || req.UserID == project.OwnerID {
+		c.JSON(http.StatusConflict, gin.H{"error": "Пользователь уже является участником проекта"})
+		return
+	}
+
+	member := ProjectMember{
+		ProjectID: project.ID,
+		UserID:    req.UserID,
+		Role:      req.Role,
+		CreatedAt: time.Now(),
+	}
+	if err := db.WithContext(c).Create(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка добавления участника: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+func updateProjectMember(c *gin.Context) {
+	project, userID, role := loadProject(c)
+	if project == nil {
+		return
+	}
+	if !canManageProject(project, userID, role) {
+		abortProjectForbidden(c, project)
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор пользователя"})
+		return
+	}
+
+	var req ProjectMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+	if !assignableProjectRoles[req.Role] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: роль должна быть manager, member или viewer"})
+		return
+	}
+	if uint(memberID) == project.OwnerID {
+		c.JSON(http.StatusConflict, gin.H{"error": "Нельзя изменить роль владельца проекта"})
+		return
+	}
+
+	var member ProjectMember
+	if err := db.WithContext(c).Where("project_id = ? AND user_id = ?", project.ID, memberID).First(&member).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Участник не найден"})
+		return
+	}
+
+	member.Role = req.Role
+	if err := db.WithContext(c).Save(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка изменения роли участника"})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+func removeProjectMember(c *gin.Context) {
+	project, userID, role := loadProject(c)
+	if project == nil {
+		return
+	}
+
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор пользователя"})
+		return
+	}
+	// Members may leave a project on their own.
+	if uint(memberID) != userID && !canManageProject(project, userID, role) {
+		abortProjectForbidden(c, project)
+		return
+	}
+	if uint(memberID) == project.OwnerID {
+		c.JSON(http.StatusConflict, gin.H{"error": "Нельзя удалить владельца проекта"})
+		return
+	}
+
+	result := db.WithContext(c).Where("project_id = ? AND user_id = ?", project.ID, memberID).Delete(&ProjectMember{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления участника"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Участник не найден"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Участник удален из проекта"})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProjectHandlersRejectMalformedIDs(t *testing.T) {
+	r := gin.New()
+	r.GET("/projects/:id", getProject)
+	r.PUT("/projects/:id", updateProject)
+	r.DELETE("/projects/:id", deleteProject)
+	r.GET("/projects/:id/members", getProjectMembers)
+
+	for _, target := range []string{
+		"GET /projects/1%20OR%201=1",
+		"PUT /projects/abc",
+		"DELETE /projects/1;DROP",
+		"GET /projects/0x1/members",
+	} {
+		method, path, _ := strings.Cut(target, " ")
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(headerUserID, "1")
+		req.Header.Set(headerUserRole, "user")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", target, w.Code)
+		}
+	}
+}
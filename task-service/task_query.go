@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTaskPageSize = 50
+	maxTaskPageSize     = 200
+)
+
+type sortKind int
+
+const (
+	sortInt sortKind = iota
+	sortFloat
+	sortString
+	sortTime
+)
+
+// taskSortColumn describes a sortable column: the SQL expression used in
+// ORDER BY and keyset comparisons, and how to read the same value from a
+// loaded Task when building a cursor.
+type taskSortColumn struct {
+	expr  string
+	kind  sortKind
+	value func(t *Task) interface{}
+}
+
+var taskPriorityRank = map[string]int64{"low": 1, "medium": 2, "high": 3, "urgent": 4}
+
+// taskSortColumns is the whitelist for the sort parameter. Nullable columns
+// are coalesced so that keyset comparisons never see NULL.
+var taskSortColumns = map[string]taskSortColumn{
+	"id":              {"id", sortInt, func(t *Task) interface{} { return t.ID }},
+	"created_at":      {"created_at", sortTime, func(t *Task) interface{} { return t.CreatedAt }},
+	"updated_at":      {"updated_at", sortTime, func(t *Task) interface{} { return t.UpdatedAt }},
+	"due_date":        {"COALESCE(due_date, '0001-01-01')", sortTime, func(t *Task) interface{} { return t.DueDate }},
+	"title":           {"title", sortString, func(t *Task) interface{} { return t.Title }},
+	"status":          {"status", sortString, func(t *Task) interface{} { return t.Status }},
+	"estimated_hours": {"COALESCE(estimated_hours, 0)", sortFloat, func(t *Task) interface{} { return t.EstimatedHours }},
+	"priority": {
+		"CASE priority WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 WHEN 'urgent' THEN 4 ELSE 0 END",
+		sortInt,
+		func(t *Task) interface{} { return taskPriorityRank[t.Priority] },
+	},
+}
+
+// taskCursor is the opaque pagination token. It pins the sort it was
+// issued for, the sort value and id of the boundary row, and whether it
+// points forwards or backwards.
+type taskCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+	Prev  bool            `json:"p,omitempty"`
+}
+
+type taskListParams struct {
+	limit        int
+	sortName     string
+	sort         taskSortColumn
+	desc         bool
+	cursor       *taskCursor
+	includeTotal bool
+
+	statuses   []string
+	priorities []string
+	assignedTo []uint
+	projectIDs []uint
+	parentIDs  []uint
+	createdBy  []uint
+	dueFrom    *time.Time
+	dueTo      *time.Time
+	dueToDate  bool // due_to was a plain date and includes the whole day
+	search     string
+}
+
+func parseTaskListParams(c *gin.Context) (*taskListParams, error) {
+	p := &taskListParams{limit: defaultTaskPageSize, includeTotal: true}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit должен быть положительным числом")
+		}
+		p.limit = min(limit, maxTaskPageSize)
+	}
+
+	p.sortName = c.DefaultQuery("sort", "-created_at")
+	name, desc := strings.CutPrefix(p.sortName, "-")
+	column, ok := taskSortColumns[name]
+	if !ok {
+		return nil, fmt.Errorf("сортировка по %q не поддерживается", name)
+	}
+	p.sort, p.desc = column, desc
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeTaskCursor(raw)
+		if err != nil || cursor.Sort != p.sortName {
+			return nil, errors.New("неверный cursor")
+		}
+		p.cursor = cursor
+	}
+
+	if raw := c.Query("include_total"); raw != "" {
+		include, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("include_total должен быть true или false")
+		}
+		p.includeTotal = include
+	}
+
+	p.statuses = splitList(c.Query("status"))
+	p.priorities = splitList(c.Query("priority"))
+
+	var err error
+	if p.assignedTo, err = parseIDList(c.Query("assigned_to")); err != nil {
+		return nil, fmt.Errorf("assigned_to: %w", err)
+	}
+	if p.projectIDs, err = parseIDList(c.Query("project_id")); err != nil {
+		return nil, fmt.Errorf("project_id: %w", err)
+	}
+	if p.parentIDs, err = parseIDList(c.Query("parent_id")); err != nil {
+		return nil, fmt.Errorf("parent_id: %w", err)
+	}
+	if p.createdBy, err = parseIDList(c.Query("created_by")); err != nil {
+		return nil, fmt.Errorf("created_by: %w", err)
+	}
+	if p.dueFrom, _, err = parseDateParam(c.Query("due_from")); err != nil {
+		return nil, fmt.Errorf("due_from: %w", err)
+	}
+	if p.dueTo, p.dueToDate, err = parseDateParam(c.Query("due_to")); err != nil {
+		return nil, fmt.Errorf("due_to: %w", err)
+	}
+	p.search = strings.TrimSpace(c.Query("q"))
+
+	return p, nil
+}
+
+// filter applies every filter except the cursor, so it is shared by the
+// page query and the total count.
+func (p *taskListParams) filter(query *gorm.DB) *gorm.DB {
+	if len(p.statuses) > 0 {
+		query = query.Where("status IN ?", p.statuses)
+	}
+	if len(p.priorities) > 0 {
+		query = query.Where("priority IN ?", p.priorities)
+	}
+	if len(p.assignedTo) > 0 {
+		query = query.Where("assigned_to IN ?", p.assignedTo)
+	}
+	if len(p.projectIDs) > 0 {
+		query = query.Where("project_id IN ?", p.projectIDs)
+	}
+	if len(p.parentIDs) > 0 {
+		query = query.Where("parent_id IN ?", p.parentIDs)
+	}
+	if len(p.createdBy) > 0 {
+		query = query.Where("created_by IN ?", p.createdBy)
+	}
+	if p.dueFrom != nil {
+		query = query.Where("due_date >= ?", *p.dueFrom)
+	}
+	if p.dueTo != nil && p.dueToDate {
+		query = query.Where("due_date < ?", p.dueTo.AddDate(0, 0, 1))
+	} else if p.dueTo != nil {
+		query = query.Where("due_date <= ?", *p.dueTo)
+	}
+	if p.search != "" {
+		pattern := "%" + escapeLike(p.search) + "%"
+		query = query.Where("(title ILIKE ? OR description ILIKE ?)", pattern, pattern)
+	}
+	return query
+}
+
+// paginate adds the keyset condition, ordering and limit. One extra row is
+// fetched to find out whether another page exists.
+func (p *taskListParams) paginate(query *gorm.DB) (*gorm.DB, error) {
+	backwards := p.cursor != nil && p.cursor.Prev
+	desc := p.desc != backwards
+
+	if p.cursor != nil {
+		value, err := decodeCursorValue(p.sort.kind, p.cursor.Value)
+		if err != nil {
+			return nil, err
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", p.sort.expr, op), value, p.cursor.ID)
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	return query.
+		Order(fmt.Sprintf("%s %s", p.sort.expr, direction)).
+		Order("id " + direction).
+		Limit(p.limit + 1), nil
+}
+
+// page trims the extra row, restores display order for backwards pages and
+// computes the cursors for the neighbouring pages.
+func (p *taskListParams) page(tasks []Task) ([]Task, string, string) {
+	backwards := p.cursor != nil && p.cursor.Prev
+	hasMore := len(tasks) > p.limit
+	if hasMore {
+		tasks = tasks[:p.limit]
+	}
+	if backwards {
+		for i, j := 0, len(tasks)-1; i < j; i, j = i+1, j-1 {
+			tasks[i], tasks[j] = tasks[j], tasks[i]
+		}
+	}
+	if len(tasks) == 0 {
+		return tasks, "", ""
+	}
+
+	hasNext := hasMore
+	hasPrev := p.cursor != nil
+	if backwards {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	var next, prev string
+	if hasNext {
+		next = p.encodeCursor(&tasks[len(tasks)-1], false)
+	}
+	if hasPrev {
+		prev = p.encodeCursor(&tasks[0], true)
+	}
+	return tasks, next, prev
+}
+
+func (p *taskListParams) encodeCursor(task *Task, prev bool) string {
+	value, _ := json.Marshal(p.sort.value(task))
+	raw, _ := json.Marshal(taskCursor{Sort: p.sortName, Value: value, ID: task.ID, Prev: prev})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeTaskCursor(raw string) (*taskCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	var cursor taskCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func decodeCursorValue(kind sortKind, raw json.RawMessage) (interface{}, error) {
+	var err error
+	switch kind {
+	case sortInt:
+		var v int64
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case sortFloat:
+		var v float64
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	case sortTime:
+		var v time.Time
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	default:
+		var v string
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	}
+}
+
+func splitList(raw string) []string {
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func parseIDList(raw string) ([]uint, error) {
+	var ids []uint
+	for _, v := range splitList(raw) {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("неверный идентификатор %q", v)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// parseDateParam accepts either RFC 3339 timestamps or plain YYYY-MM-DD
+// dates and reports which of the two it got.
+func parseDateParam(raw string) (*time.Time, bool, error) {
+	if raw == "" {
+		return nil, false, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, false, nil
+	}
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return &t, true, nil
+	}
+	return nil, false, fmt.Errorf("неверная дата %q", raw)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
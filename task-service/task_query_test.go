@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseQuery(t *testing.T, query string) (*taskListParams, error) {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/tasks?"+query, nil)
+	return parseTaskListParams(c)
+}
+
+func TestTaskCursorRoundTrip(t *testing.T) {
+	task := &Task{
+		ID:             42,
+		Title:          "Ship it",
+		Priority:       "high",
+		DueDate:        time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC),
+		EstimatedHours: 2.5,
+		CreatedAt:      time.Date(2024, 4, 1, 9, 0, 0, 123000, time.UTC),
+	}
+	tests := []struct {
+		sort string
+		want interface{}
+	}{
+		{"id", int64(42)},
+		{"-created_at", task.CreatedAt},
+		{"due_date", task.DueDate},
+		{"title", "Ship it"},
+		{"estimated_hours", 2.5},
+		{"-priority", int64(3)},
+	}
+	for _, tt := range tests {
+		for _, prev := range []bool{false, true} {
+			p, err := parseQuery(t, "sort="+tt.sort)
+			if err != nil {
+				t.Fatalf("sort=%s: %v", tt.sort, err)
+			}
+			raw := p.encodeCursor(task, prev)
+
+			p, err = parseQuery(t, "sort="+tt.sort+"&cursor="+raw)
+			if err != nil {
+				t.Fatalf("sort=%s: cursor %s rejected: %v", tt.sort, raw, err)
+			}
+			if p.cursor.ID != task.ID || p.cursor.Prev != prev {
+				t.Errorf("sort=%s: cursor = %+v, want id %d, prev %v", tt.sort, p.cursor, task.ID, prev)
+			}
+			value, err := decodeCursorValue(p.sort.kind, p.cursor.Value)
+			if err != nil {
+				t.Fatalf("sort=%s: decode value: %v", tt.sort, err)
+			}
+			if want, ok := tt.want.(time.Time); ok {
+				if !value.(time.Time).Equal(want) {
+					t.Errorf("sort=%s: value = %v, want %v", tt.sort, value, want)
+				}
+			} else if value != tt.want {
+				t.Errorf("sort=%s: value = %#v, want %#v", tt.sort, value, tt.want)
+			}
+		}
+	}
+}
+
+func TestTaskCursorInvalid(t *testing.T) {
+	p, _ := parseQuery(t, "sort=title")
+	titleCursor := p.encodeCursor(&Task{ID: 1, Title: "a"}, false)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"not base64", "cursor=@@@"},
+		{"not json", "cursor=" + base64.RawURLEncoding.EncodeToString([]byte("not json"))},
+		{"padded base64", "sort=title&cursor=" + titleCursor + "=="},
+		{"issued for another sort", "sort=-title&cursor=" + titleCursor},
+		{"issued for the default sort", "cursor=" + titleCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseQuery(t, tt.query); err == nil {
+				t.Errorf("%s accepted", tt.query)
+			}
+		})
+	}
+
+	// A cursor whose value does not match the sort kind fails when the
+	// page is queried.
+	if _, err := decodeCursorValue(sortTime, []byte(`"yesterday"`)); err == nil {
+		t.Error("a malformed time value decoded")
+	}
+}
+
+func TestDueToIncludesTheWholeDay(t *testing.T) {
+	useTestDB(t)
+	day := func(hour int) time.Time { return time.Date(2024, 5, 1, hour, 0, 0, 0, time.UTC) }
+	createTasks(t,
+		Task{Title: "morning", DueDate: day(0)},
+		Task{Title: "evening", DueDate: day(23)},
+		Task{Title: "next day", DueDate: day(24)},
+	)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"due_to=2024-05-01", []string{"morning", "evening"}},
+		{"due_to=2024-05-01T00:00:00Z", []string{"morning"}},
+		{"due_from=2024-05-01&due_to=2024-05-02", []string{"morning", "evening", "next day"}},
+		{"due_from=2024-05-01T12:00:00Z", []string{"evening", "next day"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			p, err := parseQuery(t, tt.query)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			var titles []string
+			if err := p.filter(db.Model(&Task{})).Order("due_date").Pluck("title", &titles).Error; err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			if len(titles) != len(tt.want) {
+				t.Fatalf("titles = %v, want %v", titles, tt.want)
+			}
+			for i := range titles {
+				if titles[i] != tt.want[i] {
+					t.Errorf("titles = %v, want %v", titles, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// userRef is the part of a user task-service needs to resolve a mention.
+type userRef struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// lookupUsernames resolves usernames from the users table, like userExists
+// and userRoles. Unknown names are left out.
+func lookupUsernames(c *gin.Context, names []string) ([]userRef, error) {
+	var users []userRef
+	err := db.WithContext(c).Table("users").Select("id, username").Where("username IN ?", names).Scan(&users).Error
+	return users, err
+}
+
+// userExists reports whether a user with id exists. Tasks reference the
+// users table directly, so none of these lookups need user-service.
+func userExists(c *gin.Context, id uint) (bool, error) {
+	var count int64
+	err := db.WithContext(c).Table("users").Where("id = ?", id).Count(&count).Error
+	return count > 0, err
+}
+
+// userRoles returns the roles of the users with the given IDs, read from
+// the users table. Unknown users are left out.
+func userRoles(c *gin.Context, ids []uint) (map[uint]string, error) {
+	var rows []struct {
+		ID   uint
+		Role string
+	}
+	err := db.WithContext(c).Table("users").Select("id, role").Where("id IN ?", ids).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[uint]string, len(rows))
+	for _, row := range rows {
+		roles[row.ID] = row.Role
+	}
+	return roles, nil
+}
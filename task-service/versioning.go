@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shared/conditional"
+)
+
+// errVersionConflict means the task changed between reading and writing it.
+var errVersionConflict = errors.New("task version conflict")
+
+// taskPutColumns are the columns PUT /tasks/:id overwrites.
+var taskPutColumns = []string{
+	"title", "description", "project_id", "parent_id", "assigned_to", "status", "priority",
+	"due_date", "estimated_hours", "actual_hours", "updated_at",
+}
+
+// saveTaskVersion writes columns of task only if the stored version is
+// still the one task was read with, and bumps the version. Concurrent
+// writers therefore cannot overwrite each other even without If-Match.
+func saveTaskVersion(tx *gorm.DB, task *Task, columns []string) error {
+	expected := task.Version
+	task.Version = expected + 1
+	values := taskColumnValues(task, columns)
+	values["version"] = task.Version
+	result := tx.Model(task).Where("version = ?", expected).Updates(values)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = errVersionConflict
+	}
+	if result.Error != nil {
+		task.Version = expected
+	}
+	return result.Error
+}
+
+// taskColumnValues maps columns to the values of task. Unset references and
+// an unset due date are written as NULL, which the foreign keys and
+// reports expect, rather than as zero values.
+func taskColumnValues(task *Task, columns []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(columns)+1)
+	for _, column := range columns {
+		switch column {
+		case "title":
+			values[column] = task.Title
+		case "description":
+			values[column] = task.Description
+		case "project_id":
+			values[column] = nullableID(task.ProjectID)
+		case "parent_id":
+			values[column] = task.ParentID
+		case "assigned_to":
+			values[column] = nullableID(task.AssignedTo)
+		case "status":
+			values[column] = task.Status
+		case "priority":
+			values[column] = task.Priority
+		case "due_date":
+			if task.DueDate.IsZero() {
+				values[column] = nil
+			} else {
+				values[column] = task.DueDate
+			}
+		case "estimated_hours":
+			values[column] = task.EstimatedHours
+		case "actual_hours":
+			values[column] = task.ActualHours
+		case "updated_at":
+			values[column] = task.UpdatedAt
+		}
+	}
+	return values
+}
+
+// taskNullableColumns are the columns of a new task that are stored as NULL
+// when unset.
+var taskNullableColumns = []string{"project_id", "assigned_to", "due_date"}
+
+// createTaskRow inserts task. Columns taskColumnValues would write as NULL
+// are left out of the insert, so an omitted project or assignee does not
+// become a zero id that breaks the foreign keys.
+func createTaskRow(tx *gorm.DB, task *Task) error {
+	var omit []string
+	for column, value := range taskColumnValues(task, taskNullableColumns) {
+		if value == nil {
+			omit = append(omit, column)
+		}
+	}
+	return tx.Omit(omit...).Create(task).Error
+}
+
+// nullableID returns nil for a zero id, so it is stored as NULL.
+func nullableID(id uint) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// optionalID returns nil for a zero id.
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// abortPrecondition answers a write whose precondition failed: 428 when
+// If-Match is required but missing, 412 when the task has changed.
+func abortPrecondition(c *gin.Context, err error, task *Task) {
+	if errors.Is(err, conditional.ErrPreconditionRequired) {
+		c.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{
+			"error": "Требуется заголовок If-Match с ETag задачи",
+			"code":  "precondition_required",
+		})
+		return
+	}
+	response := gin.H{
+		"error":   "Задача была изменена другим пользователем, загрузите ее заново",
+		"code":    "precondition_failed",
+		"task_id": task.ID,
+	}
+	if !errors.Is(err, errVersionConflict) {
+		response["version"] = task.Version
+		conditional.SetETag(c, task.Version)
+	}
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, response)
+}
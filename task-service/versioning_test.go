@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func TestCreateTaskRowLeavesUnsetReferencesNull(t *testing.T) {
+	dryRun, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var sql string
+	capture := func(tx *gorm.DB) { sql = tx.Statement.SQL.String() }
+	if err := dryRun.Callback().Create().After("gorm:create").Register("test:capture", capture); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		task    Task
+		omitted []string
+	}{
+		{"unset", Task{Title: "a"}, []string{"project_id", "assigned_to", "due_date"}},
+		{"project only", Task{Title: "b", ProjectID: 3}, []string{"assigned_to", "due_date"}},
+		{"all set", Task{Title: "c", ProjectID: 3, AssignedTo: 4, DueDate: time.Now()}, nil},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := createTaskRow(dryRun, &tt.task); err != nil {
+				t.Fatalf("createTaskRow: %v", err)
+			}
+			if !strings.HasPrefix(sql, "INSERT INTO `tasks`") {
+				t.Fatalf("unexpected statement: %s", sql)
+			}
+			for _, column := range taskNullableColumns {
+				want := true
+				for _, omitted := range tt.omitted {
+					if column == omitted {
+						want = false
+					}
+				}
+				if got := strings.Contains(sql, "`"+column+"`"); got != want {
+					t.Errorf("%s in insert = %v, want %v: %s", column, got, want, sql)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Task statuses. The regular flow is pending → in_progress → review →
+// completed; a task can be blocked on the way and cancelled until it is
+// completed.
+const (
+	taskStatusPending    = "pending"
+	taskStatusInProgress = "in_progress"
+	taskStatusReview     = "review"
+	taskStatusCompleted  = "completed"
+	taskStatusBlocked    = "blocked"
+	taskStatusCancelled  = "cancelled"
+)
+
+// taskTransitions lists the allowed status changes for a task.
+var taskTransitions = map[string][]string{
+	taskStatusPending:    {taskStatusInProgress, taskStatusBlocked, taskStatusCancelled},
+	taskStatusInProgress: {taskStatusReview, taskStatusBlocked, taskStatusPending, taskStatusCancelled},
+	taskStatusReview:     {taskStatusCompleted, taskStatusInProgress, taskStatusCancelled},
+	taskStatusBlocked:    {taskStatusInProgress, taskStatusPending, taskStatusCancelled},
+	taskStatusCompleted:  {taskStatusInProgress},
+	taskStatusCancelled:  {taskStatusPending},
+}
+
+// initialTaskStatuses are the statuses a new task may be created with.
+var initialTaskStatuses = []string{taskStatusPending, taskStatusInProgress}
+
+// TaskStatusHistory records one status change of a task. The first entry of
+// a task has an empty FromStatus.
+type TaskStatusHistory struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TaskID     uint      `json:"task_id" gorm:"index;not null"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status" gorm:"not null"`
+	ChangedBy  uint      `json:"changed_by"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+func (TaskStatusHistory) TableName() string {
+	return "task_status_history"
+}
+
+func canTransitionTask(from, to string) bool {
+	for _, allowed := range taskTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func isInitialTaskStatus(status string) bool {
+	for _, allowed := range initialTaskStatuses {
+		if allowed == status {
+			return true
+		}
+	}
+	return false
+}
+
+func abortInvalidTransition(c *gin.Context, from, to string) {
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+		"error":   "Недопустимая смена статуса задачи",
+		"code":    "invalid_transition",
+		"from":    from,
+		"to":      to,
+		"allowed": taskTransitions[from],
+	})
+}
+
+// recordStatusChange appends a history entry when the status changed. It
+// runs in the transaction that saves the task.
+func recordStatusChange(tx *gorm.DB, task *Task, from string, actorID uint) error {
+	if from == task.Status {
+		return nil
+	}
+	return tx.Create(&TaskStatusHistory{
+		TaskID:     task.ID,
+		FromStatus: from,
+		ToStatus:   task.Status,
+		ChangedBy:  actorID,
+		ChangedAt:  task.UpdatedAt,
+	}).Error
+}
+
+// getTaskHistory serves GET /tasks/:id/history, oldest change first.
+func getTaskHistory(c *gin.Context) {
+	task, _, _ := loadVisibleTask(c)
+	if task == nil {
+		return
+	}
+
+	history := []TaskStatusHistory{}
+	if err := db.WithContext(c).Where("task_id = ?", task.ID).Order("changed_at, id").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки истории задачи"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": task.ID,
+		"status":  task.Status,
+		"history": history,
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var allTaskStatuses = []string{
+	taskStatusPending, taskStatusInProgress, taskStatusReview,
+	taskStatusCompleted, taskStatusBlocked, taskStatusCancelled,
+}
+
+func TestCanTransitionTask(t *testing.T) {
+	// Every allowed change; all other pairs must be refused.
+	allowed := map[[2]string]bool{
+		{taskStatusPending, taskStatusInProgress}:   true,
+		{taskStatusPending, taskStatusBlocked}:      true,
+		{taskStatusPending, taskStatusCancelled}:    true,
+		{taskStatusInProgress, taskStatusReview}:    true,
+		{taskStatusInProgress, taskStatusBlocked}:   true,
+		{taskStatusInProgress, taskStatusPending}:   true,
+		{taskStatusInProgress, taskStatusCancelled}: true,
+		{taskStatusReview, taskStatusCompleted}:     true,
+		{taskStatusReview, taskStatusInProgress}:    true,
+		{taskStatusReview, taskStatusCancelled}:     true,
+		{taskStatusBlocked, taskStatusInProgress}:   true,
+		{taskStatusBlocked, taskStatusPending}:      true,
+		{taskStatusBlocked, taskStatusCancelled}:    true,
+		{taskStatusCompleted, taskStatusInProgress}: true,
+		{taskStatusCancelled, taskStatusPending}:    true,
+	}
+	for _, from := range allTaskStatuses {
+		for _, to := range allTaskStatuses {
+			want := allowed[[2]string{from, to}]
+			if got := canTransitionTask(from, to); got != want {
+				t.Errorf("canTransitionTask(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	for _, tt := range [][2]string{
+		{"", taskStatusPending},
+		{taskStatusPending, ""},
+		{"archived", taskStatusPending},
+		{taskStatusPending, "archived"},
+	} {
+		if canTransitionTask(tt[0], tt[1]) {
+			t.Errorf("canTransitionTask(%q, %q) = true for an unknown status", tt[0], tt[1])
+		}
+	}
+}
+
+func TestIsInitialTaskStatus(t *testing.T) {
+	want := map[string]bool{taskStatusPending: true, taskStatusInProgress: true}
+	for _, status := range append(allTaskStatuses, "", "archived") {
+		if got := isInitialTaskStatus(status); got != want[status] {
+			t.Errorf("isInitialTaskStatus(%q) = %v, want %v", status, got, want[status])
+		}
+	}
+}
+
+func TestGetTaskHistoryRejectsMalformedID(t *testing.T) {
+	r := gin.New()
+	r.GET("/tasks/:id/history", getTaskHistory)
+
+	req := httptest.NewRequest(http.MethodGet, "/tasks/1%20OR%201=1/history", nil)
+	req.Header.Set(headerUserID, "1")
+	req.Header.Set(headerUserRole, "user")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
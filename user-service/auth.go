@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The api-gateway verifies the caller's token and forwards the identity in
+// these headers. Clients cannot set them because the gateway strips them.
+const (
+	headerUserID   = "X-User-ID"
+	headerUserRole = "X-User-Role"
+)
+
+// currentUser returns the caller identity propagated by the api-gateway.
+func currentUser(c *gin.Context) (uint, string, bool) {
+	id, err := strconv.ParseUint(c.GetHeader(headerUserID), 10, 64)
+	if err != nil || id == 0 {
+		return 0, "", false
+	}
+	return uint(id), c.GetHeader(headerUserRole), true
+}
+
+// authorizeUserParam parses :id and lets the request through when the
+// caller is that user or an admin. It returns the target id and the
+// caller's role, or writes the error response itself.
+func authorizeUserParam(c *gin.Context) (uint, string, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор пользователя"})
+		return 0, "", false
+	}
+	callerID, callerRole, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется аутентификация"})
+		return 0, "", false
+	}
+	if callerID != uint(id) && callerRole != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+		return 0, "", false
+	}
+	return uint(id), callerRole, true
+}
+
+// requireAdmin lets only admins through.
+func requireAdmin(c *gin.Context) bool {
+	_, role, ok := currentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется аутентификация"})
+		return false
+	}
+	if role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+		return false
+	}
+	return true
+}
+
+// checkRoleChange allows only admins to change a user's role.
+func checkRoleChange(c *gin.Context, callerRole, from, to string) bool {
+	if from != to && callerRole != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав для смены роли"})
+		return false
+	}
+	return true
+}
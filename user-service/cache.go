@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+	"shared/bootstrap"
+	"shared/metrics"
+)
+
+// List pages are cached under keys that embed a version number. Writes bump
+// the version instead of hunting down every cached query; stale pages simply
+// expire.
+const (
+	usersListVersionKey     = "users:list:version"
+	usersListCacheKeyPrefix = "users:list:"
+	userCacheKeyPrefix      = "users:"
+)
+
+// cacheStats counts cache lookups since the service started.
+type cacheStats struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+	errors atomic.Int64
+}
+
+var (
+	userCacheTTL     = 5 * time.Minute
+	userListCacheTTL = time.Minute
+	// cacheLoadTimeout bounds a load shared by concurrent misses. It does
+	// not end with the request that started it.
+	cacheLoadTimeout = 10 * time.Second
+
+	stats cacheStats
+	// loads collapses concurrent misses for the same key into a single
+	// database query so an expired hot key does not stampede the database.
+	loads singleflight.Group
+)
+
+func initCacheConfig() {
+	userCacheTTL = bootstrap.EnvDuration("USER_CACHE_TTL", userCacheTTL)
+	userListCacheTTL = bootstrap.EnvDuration("USER_LIST_CACHE_TTL", userListCacheTTL)
+
+	if err := metrics.RegisterCache("users", stats.hits.Load, stats.misses.Load, stats.errors.Load); err != nil {
+		slog.Warn("Failed to register cache metrics", "error", err)
+	}
+}
+
+// userCacheKey builds the key from the parsed id so that "/users/01" and
+// "/users/1" share one entry.
+func userCacheKey(id uint) string {
+	return userCacheKeyPrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+// storeUnlessInvalidated sets KEYS[1] to ARGV[1] for ARGV[3] milliseconds
+// only while the list version in KEYS[2] is still ARGV[2]. Every write bumps
+// that version after it commits, so a load that read the database before a
+// write cannot store its stale result after the write invalidated the key.
+var storeUnlessInvalidated = redis.NewScript(`
+if (redis.call("GET", KEYS[2]) or "") ~= ARGV[2] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+return 1
+`)
+
+// cached returns the value stored under key, or calls load, stores its
+// result for ttl and returns it. Redis failures fall back to load so the
+// cache never makes the service unavailable.
+//
+// Concurrent misses share one load, so load gets a context detached from
+// the request that happened to start it: that request ending must not fail
+// the others.
+func cached[T any](ctx context.Context, key string, ttl time.Duration, load func(context.Context) (T, error)) (T, error) {
+	var value T
+
+	raw, err := redisClient.Get(ctx, key).Bytes()
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(raw, &value); err == nil {
+			stats.hits.Add(1)
+			return value, nil
+		}
+		stats.errors.Add(1)
+	case errors.Is(err, redis.Nil):
+	default:
+		stats.errors.Add(1)
+	}
+	stats.misses.Add(1)
+
+	result, err, _ := loads.Do(key, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheLoadTimeout)
+		defer cancel()
+
+		version, err := redisClient.Get(loadCtx, usersListVersionKey).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			stats.errors.Add(1)
+			return load(loadCtx)
+		}
+		loaded, err := load(loadCtx)
+		if err != nil {
+			return loaded, err
+		}
+		if ttl > 0 {
+			if data, err := json.Marshal(loaded); err == nil {
+				keys := []string{key, usersListVersionKey}
+				if err := storeUnlessInvalidated.Run(loadCtx, redisClient, keys, data, version, ttl.Milliseconds()).Err(); err != nil {
+					stats.errors.Add(1)
+				}
+			}
+		}
+		return loaded, nil
+	})
+	if err != nil {
+		return value, err
+	}
+	return result.(T), nil
+}
+
+// usersListVersion returns the current list cache version. A failure is
+// reported so the caller can bypass the cache rather than serve pages from a
+// version that may already have been invalidated.
+func usersListVersion(ctx context.Context) (int64, error) {
+	version, err := redisClient.Get(ctx, usersListVersionKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		stats.errors.Add(1)
+	}
+	return version, err
+}
+
+// invalidateUserCache bumps the list version and, when ids are given, drops
+// the per-user keys. Bumping the version also keeps loads already running
+// from storing what they read before the write.
+func invalidateUserCache(ctx context.Context, ids ...uint) {
+	if err := redisClient.Incr(ctx, usersListVersionKey).Err(); err != nil {
+		stats.errors.Add(1)
+		slog.ErrorContext(ctx, "Failed to invalidate user list cache", "error", err)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, userCacheKey(id))
+	}
+	if err := redisClient.Del(ctx, keys...).Err(); err != nil {
+		stats.errors.Add(1)
+		slog.ErrorContext(ctx, "Failed to invalidate user cache", "error", err)
+	}
+}
+
+func cacheStatsSnapshot() map[string]interface{} {
+	hits, misses := stats.hits.Load(), stats.misses.Load()
+	ratio := 0.0
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses)
+	}
+	return map[string]interface{}{
+		"hits":      hits,
+		"misses":    misses,
+		"errors":    stats.errors.Load(),
+		"hit_ratio": ratio,
+	}
+}
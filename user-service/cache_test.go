@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// useMiniredis points redisClient at a fresh in-memory Redis and resets the
+// cache statistics.
+func useMiniredis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	previous := redisClient
+	redisClient = client
+	t.Cleanup(func() {
+		client.Close()
+		redisClient = previous
+	})
+	stats.hits.Store(0)
+	stats.misses.Store(0)
+	stats.errors.Store(0)
+	return server
+}
+
+type cachedUser struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestCachedHitAndMiss(t *testing.T) {
+	server := useMiniredis(t)
+	ctx := context.Background()
+
+	var loads int
+	load := func(context.Context) (cachedUser, error) {
+		loads++
+		return cachedUser{ID: 1, Name: "alice"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		user, err := cached(ctx, userCacheKey(1), time.Minute, load)
+		if err != nil {
+			t.Fatalf("cached: %v", err)
+		}
+		if user.Name != "alice" {
+			t.Fatalf("user = %+v", user)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("load called %d times, want 1", loads)
+	}
+	if hits, misses := stats.hits.Load(), stats.misses.Load(); hits != 2 || misses != 1 {
+		t.Errorf("hits/misses = %d/%d, want 2/1", hits, misses)
+	}
+	if ttl := server.TTL(userCacheKey(1)); ttl != time.Minute {
+		t.Errorf("TTL = %v, want 1m", ttl)
+	}
+
+	// Once the entry expires the value is loaded again.
+	server.FastForward(time.Minute + time.Second)
+	if _, err := cached(ctx, userCacheKey(1), time.Minute, load); err != nil {
+		t.Fatalf("cached: %v", err)
+	}
+	if loads != 2 {
+		t.Errorf("load called %d times after expiry, want 2", loads)
+	}
+}
+
+func TestCachedLoadErrorIsNotStored(t *testing.T) {
+	server := useMiniredis(t)
+	errLoad := errors.New("database down")
+
+	_, err := cached(context.Background(), userCacheKey(2), time.Minute, func(context.Context) (cachedUser, error) {
+		return cachedUser{}, errLoad
+	})
+	if !errors.Is(err, errLoad) {
+		t.Fatalf("err = %v, want %v", err, errLoad)
+	}
+	if server.Exists(userCacheKey(2)) {
+		t.Error("a failed load was cached")
+	}
+}
+
+func TestCachedCorruptEntryIsReloaded(t *testing.T) {
+	server := useMiniredis(t)
+	server.Set(userCacheKey(3), "{not json")
+
+	user, err := cached(context.Background(), userCacheKey(3), time.Minute, func(context.Context) (cachedUser, error) {
+		return cachedUser{ID: 3, Name: "carol"}, nil
+	})
+	if err != nil || user.Name != "carol" {
+		t.Fatalf("cached = %+v, %v", user, err)
+	}
+	if stats.errors.Load() != 1 {
+		t.Errorf("errors = %d, want 1", stats.errors.Load())
+	}
+	if raw, _ := server.Get(userCacheKey(3)); raw != `{"id":3,"name":"carol"}` {
+		t.Errorf("stored value = %s", raw)
+	}
+}
+
+func TestCachedFallsBackWhenRedisIsDown(t *testing.T) {
+	server := useMiniredis(t)
+	server.Close()
+
+	user, err := cached(context.Background(), userCacheKey(4), time.Minute, func(context.Context) (cachedUser, error) {
+		return cachedUser{ID: 4, Name: "dave"}, nil
+	})
+	if err != nil || user.Name != "dave" {
+		t.Fatalf("cached = %+v, %v", user, err)
+	}
+	if stats.errors.Load() == 0 {
+		t.Error("Redis failures were not counted")
+	}
+}
+
+func TestCachedCollapsesConcurrentMisses(t *testing.T) {
+	useMiniredis(t)
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (cachedUser, error) {
+		loads.Add(1)
+		<-release
+		return cachedUser{ID: 5, Name: "erin"}, nil
+	}
+
+	const callers = 10
+	var started, done sync.WaitGroup
+	started.Add(callers)
+	done.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			defer done.Done()
+			started.Done()
+			if _, err := cached(context.Background(), userCacheKey(5), time.Minute, load); err != nil {
+				t.Errorf("cached: %v", err)
+			}
+		}()
+	}
+	started.Wait()
+	// Give every caller time to miss and join the in-flight load.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	done.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("load called %d times, want 1", n)
+	}
+}
+
+func TestCachedLoadOutlivesTheCaller(t *testing.T) {
+	useMiniredis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The request that started the load goes away while it runs; callers
+	// sharing the load must still get the value.
+	user, err := cached(ctx, userCacheKey(8), time.Minute, func(loadCtx context.Context) (cachedUser, error) {
+		cancel()
+		if err := loadCtx.Err(); err != nil {
+			return cachedUser{}, err
+		}
+		return cachedUser{ID: 8, Name: "frank"}, nil
+	})
+	if err != nil || user.Name != "frank" {
+		t.Fatalf("cached = %+v, %v; want the loaded user", user, err)
+	}
+}
+
+func TestCachedDoesNotStoreAfterInvalidation(t *testing.T) {
+	server := useMiniredis(t)
+	ctx := context.Background()
+
+	// A write commits and invalidates the user while the load that read the
+	// old row is still running.
+	user, err := cached(ctx, userCacheKey(9), time.Minute, func(context.Context) (cachedUser, error) {
+		invalidateUserCache(ctx, 9)
+		return cachedUser{ID: 9, Name: "stale"}, nil
+	})
+	if err != nil || user.Name != "stale" {
+		t.Fatalf("cached = %+v, %v", user, err)
+	}
+	if server.Exists(userCacheKey(9)) {
+		t.Error("a load that started before the invalidation was stored")
+	}
+
+	// The next load starts after the write and is stored.
+	if _, err := cached(ctx, userCacheKey(9), time.Minute, func(context.Context) (cachedUser, error) {
+		return cachedUser{ID: 9, Name: "fresh"}, nil
+	}); err != nil {
+		t.Fatalf("cached: %v", err)
+	}
+	if raw, _ := server.Get(userCacheKey(9)); raw != `{"id":9,"name":"fresh"}` {
+		t.Errorf("stored value = %q, want the fresh user", raw)
+	}
+}
+
+func TestInvalidateUserCache(t *testing.T) {
+	server := useMiniredis(t)
+	ctx := context.Background()
+	server.Set(userCacheKey(6), `{"id":6}`)
+	server.Set(userCacheKey(7), `{"id":7}`)
+
+	before, err := usersListVersion(ctx)
+	if err != nil || before != 0 {
+		t.Fatalf("usersListVersion = %d, %v; want 0", before, err)
+	}
+
+	invalidateUserCache(ctx, 6)
+
+	after, err := usersListVersion(ctx)
+	if err != nil || after != before+1 {
+		t.Errorf("usersListVersion = %d, %v; want %d", after, err, before+1)
+	}
+	if server.Exists(userCacheKey(6)) {
+		t.Error("invalidated user is still cached")
+	}
+	if !server.Exists(userCacheKey(7)) {
+		t.Error("other users were dropped from the cache")
+	}
+}
+
+func TestGetUserNormalisesID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := useMiniredis(t)
+	server.Set(userCacheKey(8), `{"id":8,"username":"dave"}`)
+
+	r := gin.New()
+	r.GET("/users/:id", getUser)
+
+	for _, id := range []string{"8", "08", "008"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/"+id, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"username":"dave"`) {
+			t.Errorf("GET /users/%s = %d %s, want the cached user", id, w.Code, w.Body)
+		}
+	}
+	for _, id := range []string{"1%20OR%201=1", "abc", "-1"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/"+id, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET /users/%s = %d, want 400", id, w.Code)
+		}
+	}
+}
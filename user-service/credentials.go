@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	minPasswordLength = 8
+	maxFailedAttempts = 5
+	lockoutDuration   = 15 * time.Minute
+)
+
+// UserCredential stores the password hash separately from User so the hash
+// can never leak through the user endpoints.
+type UserCredential struct {
+	UserID            uint       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	PasswordHash      string     `json:"-" gorm:"not null"`
+	PasswordChangedAt time.Time  `json:"password_changed_at"`
+	FailedAttempts    int        `json:"failed_attempts"`
+	LockedUntil       *time.Time `json:"locked_until"`
+	MustChange        bool       `json:"must_change"`
+}
+
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type PasswordResetRequest struct {
+	NewPassword string `json:"new_password"`
+}
+
+type VerifyRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// dummyPasswordHash is compared against when the username is unknown, so
+// that unknown users take as long to reject as wrong passwords.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", errors.New("пароль должен содержать не менее 8 символов")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func setPassword(tx *gorm.DB, userID uint, password string, mustChange bool) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return savePasswordHash(tx, userID, hash, mustChange)
+}
+
+// savePasswordHash stores a hash made by hashPassword.
+func savePasswordHash(tx *gorm.DB, userID uint, hash string, mustChange bool) error {
+	credential := UserCredential{
+		UserID:            userID,
+		PasswordHash:      hash,
+		PasswordChangedAt: time.Now(),
+		MustChange:        mustChange,
+	}
+	// Save upserts by primary key and also clears any lockout state.
+	return tx.Save(&credential).Error
+}
+
+func generateTemporaryPassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// verifyCredentials is used by the api-gateway login flow.
+func verifyCredentials(c *gin.Context) {
+	var req VerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	// Unknown users, wrong passwords and locked accounts get the same answer;
+	// only the owner of the password learns that the account is locked.
+	var user User
+	var credential UserCredential
+	if err := db.WithContext(c).Where("username = ?", req.Username).First(&user).Error; err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(req.Password))
+		abortInvalidCredentials(c)
+		return
+	}
+	if err := db.WithContext(c).First(&credential, user.ID).Error; err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(req.Password))
+		abortInvalidCredentials(c)
+		return
+	}
+
+	now := time.Now()
+	passwordOK := bcrypt.CompareHashAndPassword([]byte(credential.PasswordHash), []byte(req.Password)) == nil
+	if credential.LockedUntil != nil && credential.LockedUntil.After(now) {
+		if !passwordOK {
+			abortInvalidCredentials(c)
+			return
+		}
+		c.JSON(http.StatusLocked, gin.H{
+			"error":        "Учетная запись временно заблокирована",
+			"locked_until": credential.LockedUntil.Format(time.RFC3339),
+		})
+		return
+	}
+
+	if !passwordOK {
+		updates := map[string]interface{}{"failed_attempts": gorm.Expr("failed_attempts + 1")}
+		if credential.FailedAttempts+1 >= maxFailedAttempts {
+			updates["locked_until"] = now.Add(lockoutDuration)
+			updates["failed_attempts"] = 0
+		}
+		db.WithContext(c).Model(&UserCredential{}).Where("user_id = ?", user.ID).Updates(updates)
+		abortInvalidCredentials(c)
+		return
+	}
+
+	if credential.FailedAttempts > 0 || credential.LockedUntil != nil {
+		db.WithContext(c).Model(&UserCredential{}).Where("user_id = ?", user.ID).
+			Updates(map[string]interface{}{"failed_attempts": 0, "locked_until": nil})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":                   user.ID,
+		"username":             user.Username,
+		"role":                 user.Role,
+		"must_change_password": credential.MustChange,
+	})
+}
+
+func abortInvalidCredentials(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Неверное имя пользователя или пароль"})
+}
+
+// changePassword lets a user change their own password. Admins may change
+// any password without knowing the current one.
+func changePassword(c *gin.Context) {
+	id, _, ok := authorizeUserParam(c)
+	if !ok {
+		return
+	}
+	callerID, _, _ := currentUser(c)
+	isSelf := callerID == id
+
+	var req PasswordChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+		return
+	}
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	if isSelf {
+		var credential UserCredential
+		if err := db.WithContext(c).First(&credential, id).Error; err == nil {
+			if bcrypt.CompareHashAndPassword([]byte(credential.PasswordHash), []byte(req.CurrentPassword)) != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Текущий пароль указан неверно"})
+				return
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка смены пароля"})
+			return
+		}
+	}
+
+	if err := db.WithContext(c).First(&User{}, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+
+	if err := setPassword(db.WithContext(c), uint(id), req.NewPassword, false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка смены пароля: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Пароль успешно изменен"})
+}
+
+// resetPassword is the admin reset flow. If no new password is supplied a
+// temporary one is generated and returned once; the user must change it.
+func resetPassword(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор пользователя"})
+		return
+	}
+
+	if !requireAdmin(c) {
+		return
+	}
+
+	var req PasswordResetRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+			return
+		}
+	}
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	if err := db.WithContext(c).First(&User{}, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+
+	password := req.NewPassword
+	generated := password == ""
+	if generated {
+		if password, err = generateTemporaryPassword(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сброса пароля"})
+			return
+		}
+	}
+
+	if err := setPassword(db.WithContext(c), uint(id), password, true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка сброса пароля: " + err.Error()})
+		return
+	}
+
+	response := gin.H{"message": "Пароль успешно сброшен"}
+	if generated {
+		response["temporary_password"] = password
+	}
+	c.JSON(http.StatusOK, response)
+}
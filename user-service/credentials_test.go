@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB points db at a fresh in-memory SQLite database with the user
+// tables and one user, alice, whose password is "password123".
+func useTestDB(t *testing.T) *User {
+	t.Helper()
+	testDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	// Every connection to :memory: is a separate database.
+	sqlDB, err := testDB.DB()
+	if err != nil {
+		t.Fatalf("sqlite pool: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := testDB.AutoMigrate(&User{}, &UserCredential{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	previous := db
+	db = testDB
+	t.Cleanup(func() {
+		db = previous
+		sqlDB.Close()
+	})
+
+	user := &User{Username: "alice", Email: "alice@example.com", Role: "user", Version: 1}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := setPassword(db, user.ID, "password123", false); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	return user
+}
+
+func newCredentialsRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/users/verify", verifyCredentials)
+	r.POST("/users/:id/password", changePassword)
+	r.POST("/users/:id/password/reset", resetPassword)
+	return r
+}
+
+// post sends body to path as the given caller; an empty callerID is
+// anonymous.
+func post(r *gin.Engine, path, body string, callerID, callerRole string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if callerID != "" {
+		req.Header.Set(headerUserID, callerID)
+		req.Header.Set(headerUserRole, callerRole)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func verify(r *gin.Engine, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(VerifyRequest{Username: username, Password: password})
+	return post(r, "/users/verify", string(body), "", "")
+}
+
+func loadCredential(t *testing.T, userID uint) UserCredential {
+	t.Helper()
+	var credential UserCredential
+	if err := db.First(&credential, userID).Error; err != nil {
+		t.Fatalf("load credential: %v", err)
+	}
+	return credential
+}
+
+func TestVerifyCredentials(t *testing.T) {
+	user := useTestDB(t)
+	r := newCredentialsRouter()
+
+	if w := verify(r, "alice", "wrong-password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want 401", w.Code)
+	}
+	if w := verify(r, "nobody", "password123"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown user: status = %d, want 401", w.Code)
+	}
+	if got := loadCredential(t, user.ID).FailedAttempts; got != 1 {
+		t.Errorf("failed attempts = %d, want 1", got)
+	}
+
+	w := verify(r, "alice", "password123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("correct password: status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	var resp struct {
+		ID                 uint   `json:"id"`
+		Role               string `json:"role"`
+		MustChangePassword bool   `json:"must_change_password"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.ID != user.ID || resp.Role != "user" || resp.MustChangePassword {
+		t.Errorf("response = %+v, want user %d with role user", resp, user.ID)
+	}
+	if got := loadCredential(t, user.ID).FailedAttempts; got != 0 {
+		t.Errorf("failed attempts after login = %d, want 0", got)
+	}
+}
+
+func TestVerifyCredentialsLockout(t *testing.T) {
+	user := useTestDB(t)
+	r := newCredentialsRouter()
+
+	for i := 1; i < maxFailedAttempts; i++ {
+		verify(r, "alice", "wrong-password")
+	}
+	if credential := loadCredential(t, user.ID); credential.LockedUntil != nil {
+		t.Fatalf("locked after %d failures, want %d", maxFailedAttempts-1, maxFailedAttempts)
+	}
+	verify(r, "alice", "wrong-password")
+	credential := loadCredential(t, user.ID)
+	if credential.LockedUntil == nil || !credential.LockedUntil.After(time.Now()) {
+		t.Fatalf("not locked after %d failures", maxFailedAttempts)
+	}
+
+	// Only the right password learns about the lockout.
+	if w := verify(r, "alice", "wrong-password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password while locked: status = %d, want 401", w.Code)
+	}
+	if w := verify(r, "alice", "password123"); w.Code != http.StatusLocked {
+		t.Errorf("correct password while locked: status = %d, want 423", w.Code)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	db.Model(&UserCredential{}).Where("user_id = ?", user.ID).Update("locked_until", expired)
+	if w := verify(r, "alice", "password123"); w.Code != http.StatusOK {
+		t.Errorf("correct password after lockout: status = %d, want 200", w.Code)
+	}
+	if credential := loadCredential(t, user.ID); credential.LockedUntil != nil {
+		t.Errorf("lockout not cleared after a successful login")
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	user := useTestDB(t)
+	r := newCredentialsRouter()
+	id := strconv.FormatUint(uint64(user.ID), 10)
+	path := "/users/" + id + "/password/reset"
+
+	if w := post(r, path, "", id, "user"); w.Code != http.StatusForbidden {
+		t.Errorf("reset by the user: status = %d, want 403", w.Code)
+	}
+	if w := post(r, path, `{"new_password":"short"}`, "99", "admin"); w.Code != http.StatusBadRequest {
+		t.Errorf("short password: status = %d, want 400", w.Code)
+	}
+
+	w := post(r, path, "", "99", "admin")
+	if w.Code != http.StatusOK {
+		t.Fatalf("reset: status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	var resp struct {
+		TemporaryPassword string `json:"temporary_password"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.TemporaryPassword == "" {
+		t.Fatalf("no temporary password in %s", w.Body)
+	}
+
+	if w := verify(r, "alice", "password123"); w.Code != http.StatusUnauthorized {
+		t.Errorf("old password after reset: status = %d, want 401", w.Code)
+	}
+	w = verify(r, "alice", resp.TemporaryPassword)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"must_change_password":true`) {
+		t.Errorf("temporary password: %d %s, want 200 with must_change_password", w.Code, w.Body)
+	}
+
+	change := `{"current_password":"` + resp.TemporaryPassword + `","new_password":"new-password"}`
+	if w := post(r, "/users/"+id+"/password", change, id, "user"); w.Code != http.StatusOK {
+		t.Fatalf("change: status = %d, want 200 (body %s)", w.Code, w.Body)
+	}
+	if loadCredential(t, user.ID).MustChange {
+		t.Error("must_change still set after the user changed the password")
+	}
+}
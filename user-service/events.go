@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"shared/events"
+)
+
+const eventSource = "user-service"
+
+var publisher events.Publisher = events.Nop{}
+
+func initEvents() {
+	publisher = events.FromEnv(redisClient)
+}
+
+// publishUserEvent is best effort: a failure to publish is logged but never
+// fails the request that caused it.
+func publishUserEvent(c *gin.Context, eventType string, user *User) {
+	actorID, _, _ := currentUser(c)
+	event, err := events.New(eventType, eventSource, actorID, events.UserData{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     user.Role,
+	})
+	if err == nil {
+		err = publisher.Publish(c, event)
+	}
+	if err != nil {
+		slog.ErrorContext(c, "Failed to publish event", "event_type", eventType, "user_id", user.ID, "error", err)
+	}
+}
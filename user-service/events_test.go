@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"shared/events"
+)
+
+func TestPublishUserEvent(t *testing.T) {
+	bus := events.NewMemory()
+	previous := publisher
+	publisher = bus
+	t.Cleanup(func() { publisher = previous })
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/users", nil)
+	c.Request.Header.Set(headerUserID, "1")
+	c.Request.Header.Set(headerUserRole, "admin")
+
+	publishUserEvent(c, events.UserCreated, &User{ID: 42, Username: "dave", Email: "dave@example.com", Role: "user"})
+
+	published := bus.Events()
+	if len(published) != 1 {
+		t.Fatalf("published %d events, want 1", len(published))
+	}
+	event := published[0]
+	if event.Type != events.UserCreated || event.Source != eventSource || event.ActorID != 1 {
+		t.Errorf("envelope = %+v", event)
+	}
+	var data events.UserData
+	if err := event.Decode(&data); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := events.UserData{UserID: 42, Username: "dave", Email: "dave@example.com", Role: "user"}
+	if data != want {
+		t.Errorf("data = %+v, want %+v", data, want)
+	}
+}
@@ -1,16 +1,19 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"shared/bootstrap"
+	"shared/conditional"
+	"shared/events"
+	"shared/logging"
 )
 
 type User struct {
@@ -22,6 +25,7 @@ type User struct {
 	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version" gorm:"not null;default:1"`
 }
 
 type UserCreateRequest struct {
@@ -30,6 +34,7 @@ type UserCreateRequest struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Role      string `json:"role"`
+	Password  string `json:"password"`
 }
 
 var (
@@ -38,42 +43,16 @@ var (
 )
 
 func main() {
-	initDB()
-	initRedis()
+	app := bootstrap.New("user-service", "8081")
 
-	r := gin.Default()
+	initDB(app)
+	redisClient = app.OpenRedis()
+	initCacheConfig()
+	initEvents()
 
-	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		_, redisErr := redisClient.Ping(c).Result()
-		redisStatus := "OK"
-		if redisErr != nil {
-			redisStatus = "ERROR"
-		}
-
-		var dbStatus string
-		if db != nil {
-			sqlDB, err := db.DB()
-			if err == nil {
-				err = sqlDB.Ping()
-				if err == nil {
-					dbStatus = "OK"
-				} else {
-					dbStatus = "ERROR"
-				}
-			} else {
-				dbStatus = "ERROR"
-			}
-		} else {
-			dbStatus = "ERROR"
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"status":    "User Service OK",
-			"database":  dbStatus,
-			"redis":     redisStatus,
-			"timestamp": time.Now().Format(time.RFC3339),
-		})
+	r := app.Router
+	app.RegisterHealth("User Service OK", func(c *gin.Context) gin.H {
+		return gin.H{"cache": cacheStatsSnapshot()}
 	})
 
 	// User routes
@@ -81,65 +60,77 @@ func main() {
 	r.GET("/users/:id", getUser)
 	r.POST("/users", createUser)
 	r.PUT("/users/:id", updateUser)
+	r.PATCH("/users/:id", patchUser)
 	r.DELETE("/users/:id", deleteUser)
 	r.GET("/users/stats", getUserStats)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
-	}
+	// Credential routes
+	r.POST("/users/verify", verifyCredentials)
+	r.POST("/users/:id/password", changePassword)
+	r.POST("/users/:id/password/reset", resetPassword)
 
-	log.Printf("User service running on port %s", port)
-	log.Fatal(r.Run(":" + port))
+	app.Run()
 }
 
-func initDB() {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"), os.Getenv("DB_PORT"))
-
+func initDB(app *bootstrap.App) {
 	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err = app.OpenDB()
 	if err != nil {
-		log.Printf("Failed to connect to database: %v", err)
-	} else {
-		log.Println("Successfully connected to database")
-		db.AutoMigrate(&User{})
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
-}
-
-func initRedis() {
-	redisAddr := fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT"))
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		Password: "",
-		DB:       0,
-	})
+	db.AutoMigrate(&User{}, &UserCredential{})
 }
 
 func getUsers(c *gin.Context) {
-	var users []User
-	if db != nil {
-		db.Find(&users)
+	params, err := parseUserListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные параметры: " + err.Error()})
+		return
+	}
+
+	var page userPage
+	if version, verr := usersListVersion(c); verr == nil {
+		page, err = cached(c, params.cacheKey(version), userListCacheTTL, params.load)
+	} else {
+		page, err = params.load(c)
 	}
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка загрузки пользователей"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 func getUser(c *gin.Context) {
-	id := c.Param("id")
-	var user User
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор пользователя"})
+		return
+	}
 
-	if db != nil {
-		result := db.First(&user, id)
-		if result.Error != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
-			return
+	user, err := cached(c, userCacheKey(uint(id)), userCacheTTL, func(ctx context.Context) (User, error) {
+		var user User
+		if db != nil {
+			return user, db.WithContext(ctx).First(&user, id).Error
 		}
+		return user, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+	if conditional.NotModified(c, user.Version) {
+		return
 	}
 	c.JSON(http.StatusOK, user)
 }
 
+// createUser is for admins; accounts are not self-registered.
 func createUser(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
 	var req UserCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
@@ -160,30 +151,60 @@ func createUser(c *gin.Context) {
 
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
+	user.Version = 1
+
+	// The password is hashed before the transaction so that a weak one is
+	// rejected without creating the user.
+	var passwordHash string
+	if req.Password != "" {
+		var err error
+		if passwordHash, err = hashPassword(req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные: " + err.Error()})
+			return
+		}
+	}
 
 	if db != nil {
-		result := db.Create(&user)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания пользователя: " + result.Error.Error()})
+		err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if passwordHash != "" {
+				return savePasswordHash(tx, user.ID, passwordHash, false)
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания пользователя: " + err.Error()})
 			return
 		}
 		// Invalidate cache
-		redisClient.Del(c, "users:all")
+		invalidateUserCache(c)
+		publishUserEvent(c, events.UserCreated, &user)
 	}
 
+	conditional.SetETag(c, user.Version)
 	c.JSON(http.StatusCreated, user)
 }
 
 func updateUser(c *gin.Context) {
-	id := c.Param("id")
 	var user User
 
+	id, callerRole, ok := authorizeUserParam(c)
+	if !ok {
+		return
+	}
+
 	if db != nil {
-		result := db.First(&user, id)
+		result := db.WithContext(c).First(&user, id)
 		if result.Error != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
 			return
 		}
+		if err := conditional.CheckIfMatch(c, user.Version); err != nil {
+			abortPrecondition(c, err, &user)
+			return
+		}
 
 		var updateData UserCreateRequest
 		if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -191,6 +212,14 @@ func updateUser(c *gin.Context) {
 			return
 		}
 
+		// An omitted role keeps the current one.
+		if updateData.Role == "" {
+			updateData.Role = user.Role
+		}
+		if !checkRoleChange(c, callerRole, user.Role, updateData.Role) {
+			return
+		}
+
 		user.Username = updateData.Username
 		user.Email = updateData.Email
 		user.FirstName = updateData.FirstName
@@ -198,29 +227,62 @@ func updateUser(c *gin.Context) {
 		user.Role = updateData.Role
 		user.UpdatedAt = time.Now()
 
-		db.Save(&user)
+		err := saveUserVersion(db.WithContext(c), &user, userPutColumns)
+		if errors.Is(err, errVersionConflict) {
+			abortPrecondition(c, err, &user)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления пользователя"})
+			return
+		}
 		// Invalidate cache
-		redisClient.Del(c, "users:all")
+		invalidateUserCache(c, id)
+		publishUserEvent(c, events.UserUpdated, &user)
 	}
 
+	conditional.SetETag(c, user.Version)
 	c.JSON(http.StatusOK, user)
 }
 
 func deleteUser(c *gin.Context) {
-	id := c.Param("id")
+	id, _, ok := authorizeUserParam(c)
+	if !ok {
+		return
+	}
 
 	if db != nil {
-		result := db.Delete(&User{}, id)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления пользователя"})
+		var user User
+		if err := db.WithContext(c).First(&user, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
 			return
 		}
-		if result.RowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		if err := conditional.CheckIfMatch(c, user.Version); err != nil {
+			abortPrecondition(c, err, &user)
+			return
+		}
+
+		err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("user_id = ?", user.ID).Delete(&UserCredential{}).Error; err != nil {
+				return err
+			}
+			result := tx.Where("version = ?", user.Version).Delete(&user)
+			if result.Error == nil && result.RowsAffected == 0 {
+				return errVersionConflict
+			}
+			return result.Error
+		})
+		if errors.Is(err, errVersionConflict) {
+			abortPrecondition(c, err, &user)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления пользователя"})
 			return
 		}
 		// Invalidate cache
-		redisClient.Del(c, "users:all")
+		invalidateUserCache(c, id)
+		publishUserEvent(c, events.UserDeleted, &user)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Пользователь успешно удален"})
@@ -229,7 +291,7 @@ func deleteUser(c *gin.Context) {
 func getUserStats(c *gin.Context) {
 	var total int64
 	if db != nil {
-		db.Model(&User{}).Count(&total)
+		db.WithContext(c).Model(&User{}).Count(&total)
 	}
 	c.JSON(http.StatusOK, gin.H{"total_users": total})
 }
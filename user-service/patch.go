@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"shared/conditional"
+	"shared/events"
+	"shared/mergepatch"
+)
+
+// UserPatch lists the user fields PATCH /users/:id may change. Its JSON
+// names are also the column names.
+type UserPatch struct {
+	Username  string `json:"username" binding:"required,max=50"`
+	Email     string `json:"email" binding:"required,email,max=100"`
+	FirstName string `json:"first_name" binding:"max=50"`
+	LastName  string `json:"last_name" binding:"max=50"`
+	Role      string `json:"role" binding:"required,oneof=admin manager user"`
+}
+
+// patchUser serves PATCH /users/:id with a JSON Merge Patch body. Users may
+// patch themselves; other users and roles are changed by admins only.
+func patchUser(c *gin.Context) {
+	id, callerRole, ok := authorizeUserParam(c)
+	if !ok {
+		return
+	}
+	if db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	var user User
+	if err := db.WithContext(c).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+	if err := conditional.CheckIfMatch(c, user.Version); err != nil {
+		abortPrecondition(c, err, &user)
+		return
+	}
+
+	patch := UserPatch{
+		Username:  user.Username,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      user.Role,
+	}
+	fields, err := mergepatch.Bind(c, &patch)
+	if err != nil {
+		mergepatch.Abort(c, err)
+		return
+	}
+	if len(fields) == 0 {
+		conditional.SetETag(c, user.Version)
+		c.JSON(http.StatusOK, user)
+		return
+	}
+
+	if !checkRoleChange(c, callerRole, user.Role, patch.Role) {
+		return
+	}
+	if patch.Username != user.Username && isTaken(c, "username", patch.Username, user.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Имя пользователя уже занято", "code": "username_taken"})
+		return
+	}
+	if patch.Email != user.Email && isTaken(c, "email", patch.Email, user.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email уже используется", "code": "email_taken"})
+		return
+	}
+
+	user.Username = patch.Username
+	user.Email = patch.Email
+	user.FirstName = patch.FirstName
+	user.LastName = patch.LastName
+	user.Role = patch.Role
+	user.UpdatedAt = time.Now()
+
+	err = saveUserVersion(db.WithContext(c), &user, append(fields, "updated_at"))
+	if errors.Is(err, errVersionConflict) {
+		abortPrecondition(c, err, &user)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления пользователя"})
+		return
+	}
+	invalidateUserCache(c, id)
+	publishUserEvent(c, events.UserUpdated, &user)
+
+	conditional.SetETag(c, user.Version)
+	c.JSON(http.StatusOK, user)
+}
+
+// isTaken reports whether another user already has value in column.
+func isTaken(c *gin.Context, column, value string, userID uint) bool {
+	var count int64
+	db.WithContext(c).Model(&User{}).Where(column+" = ? AND id <> ?", value, userID).Count(&count)
+	return count > 0
+}
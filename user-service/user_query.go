@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// userSortColumns is the whitelist for the sort parameter of GET /users.
+var userSortColumns = map[string]string{
+	"created_at": "created_at",
+	"username":   "username",
+}
+
+type userListParams struct {
+	page      int
+	limit     int
+	role      string
+	search    string
+	usernames []string
+	sort      string
+}
+
+// userPage is what GET /users returns and what gets cached per query.
+type userPage struct {
+	Users []User `json:"users"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+	Total int64  `json:"total"`
+}
+
+func parseUserListParams(c *gin.Context) (*userListParams, error) {
+	p := &userListParams{page: 1, limit: defaultUserPageSize}
+
+	if raw := c.Query("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return nil, errors.New("page должен быть положительным числом")
+		}
+		p.page = page
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit должен быть положительным числом")
+		}
+		p.limit = min(limit, maxUserPageSize)
+	}
+
+	p.role = strings.TrimSpace(c.Query("role"))
+	p.search = strings.ToLower(strings.TrimSpace(c.Query("q")))
+	// username takes exact names separated by commas.
+	for _, name := range strings.Split(c.Query("username"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			p.usernames = append(p.usernames, name)
+		}
+	}
+	sort.Strings(p.usernames)
+
+	p.sort = c.DefaultQuery("sort", "created_at")
+	if _, ok := userSortColumns[strings.TrimPrefix(p.sort, "-")]; !ok {
+		return nil, fmt.Errorf("сортировка по %q не поддерживается", p.sort)
+	}
+
+	return p, nil
+}
+
+// cacheKey builds a stable key from the normalized parameters, so
+// equivalent queries share one cache entry.
+func (p *userListParams) cacheKey(version int64) string {
+	values := url.Values{}
+	values.Set("page", strconv.Itoa(p.page))
+	values.Set("limit", strconv.Itoa(p.limit))
+	values.Set("role", p.role)
+	values.Set("q", p.search)
+	values.Set("username", strings.Join(p.usernames, ","))
+	values.Set("sort", p.sort)
+	return fmt.Sprintf("%s%d:%s", usersListCacheKeyPrefix, version, values.Encode())
+}
+
+func (p *userListParams) filter(query *gorm.DB) *gorm.DB {
+	if p.role != "" {
+		query = query.Where("role = ?", p.role)
+	}
+	if len(p.usernames) > 0 {
+		query = query.Where("username IN ?", p.usernames)
+	}
+	if p.search != "" {
+		pattern := "%" + escapeLike(p.search) + "%"
+		query = query.Where(
+			"(username ILIKE ? OR email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?)",
+			pattern, pattern, pattern, pattern)
+	}
+	return query
+}
+
+func (p *userListParams) order() string {
+	name, desc := strings.CutPrefix(p.sort, "-")
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("%s %s, id %s", userSortColumns[name], direction, direction)
+}
+
+func (p *userListParams) load(ctx context.Context) (userPage, error) {
+	result := userPage{Users: []User{}, Page: p.page, Limit: p.limit}
+	if db == nil {
+		return result, nil
+	}
+	if err := p.filter(db.WithContext(ctx).Model(&User{})).Count(&result.Total).Error; err != nil {
+		return result, err
+	}
+	err := p.filter(db.WithContext(ctx).Model(&User{})).
+		Order(p.order()).
+		Offset((p.page - 1) * p.limit).
+		Limit(p.limit).
+		Find(&result.Users).Error
+	return result, err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
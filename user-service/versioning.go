@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shared/conditional"
+)
+
+// errVersionConflict means the user changed between reading and writing it.
+var errVersionConflict = errors.New("user version conflict")
+
+// userPutColumns are the columns PUT /users/:id overwrites.
+var userPutColumns = []string{"username", "email", "first_name", "last_name", "role", "updated_at"}
+
+// saveUserVersion writes columns of user only if the stored version is
+// still the one user was read with, and bumps the version.
+func saveUserVersion(tx *gorm.DB, user *User, columns []string) error {
+	expected := user.Version
+	user.Version = expected + 1
+	result := tx.Model(user).Where("version = ?", expected).
+		Select(append(columns, "version")).Updates(user)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = errVersionConflict
+	}
+	if result.Error != nil {
+		user.Version = expected
+	}
+	return result.Error
+}
+
+// abortPrecondition answers a write whose precondition failed: 428 when
+// If-Match is required but missing, 412 when the user has changed.
+func abortPrecondition(c *gin.Context, err error, user *User) {
+	if errors.Is(err, conditional.ErrPreconditionRequired) {
+		c.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{
+			"error": "Требуется заголовок If-Match с ETag пользователя",
+			"code":  "precondition_required",
+		})
+		return
+	}
+	response := gin.H{
+		"error":   "Пользователь был изменен другим пользователем, загрузите его заново",
+		"code":    "precondition_failed",
+		"user_id": user.ID,
+	}
+	if !errors.Is(err, errVersionConflict) {
+		response["version"] = user.Version
+		conditional.SetETag(c, user.Version)
+	}
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, response)
+}
@@ -4,6 +4,28 @@ import './App.css';
 
 const API_URL = process.env.REACT_APP_API_URL || 'http://localhost:8080';
 
+const USER_FIELDS = ['username', 'email', 'first_name', 'last_name', 'role'];
+const TASK_FIELDS = ['title', 'description', 'status', 'priority', 'assigned_to'];
+
+// Заголовок If-Match с версией, которую видел пользователь
+const ifMatch = (item) => (item && item.version ? { 'If-Match': `"${item.version}"` } : {});
+
+// Сервер отвечает 412, если запись успели изменить после загрузки
+const isConflict = (error) => error.response && error.response.status === 412;
+
+// Отправляет только измененные поля в формате JSON Merge Patch (RFC 7396)
+const patchChanges = (url, original, edited, fields) => {
+  const changes = {};
+  fields.forEach(field => {
+    if (edited[field] !== original[field]) {
+      changes[field] = edited[field];
+    }
+  });
+  return axios.patch(url, changes, {
+    headers: { 'Content-Type': 'application/merge-patch+json', ...ifMatch(original) }
+  });
+};
+
 function App() {
   const [users, setUsers] = useState([]);
   const [tasks, setTasks] = useState([]);
@@ -67,21 +89,22 @@ function App() {
     }
   };
 
-  const handleLogin = (e) => {
+  const handleLogin = async (e) => {
     e.preventDefault();
-    // Простая имитация авторизации
-    const user = {
-      id: 1,
-      username: loginData.username,
-      email: `${loginData.username}@company.com`,
-      first_name: 'Пользователь',
-      last_name: 'Системы',
-      role: loginData.username === 'admin' ? 'admin' : 
-            loginData.username === 'manager' ? 'manager' : 'user'
-    };
-    setCurrentUser(user);
-    setShowLogin(false);
-    showMessage(`Добро пожаловать, ${user.username}!`);
+    try {
+      const response = await axios.post(`${API_URL}/auth/login`, {
+        username: loginData.username,
+        password: loginData.password
+      });
+      const { access_token, user } = response.data;
+      axios.defaults.headers.common['Authorization'] = `Bearer ${access_token}`;
+      setCurrentUser(user);
+      setShowLogin(false);
+      showMessage(`Добро пожаловать, ${user.username}!`);
+    } catch (error) {
+      console.error('Error logging in:', error);
+      showMessage('❌ Неверное имя пользователя или пароль', 'error');
+    }
   };
 
   const handleRegister = async (e) => {
@@ -111,6 +134,7 @@ function App() {
   };
 
   const handleLogout = () => {
+    delete axios.defaults.headers.common['Authorization'];
     setCurrentUser(null);
     setShowLogin(true);
     setUsers([]);
@@ -188,12 +212,18 @@ function App() {
   const updateUser = async (e) => {
     e.preventDefault();
     try {
-      await axios.put(`${API_URL}/users/${editingUser.id}`, editingUser);
+      const original = users.find(user => user.id === editingUser.id) || {};
+      await patchChanges(`${API_URL}/users/${editingUser.id}`, original, editingUser, USER_FIELDS);
       setEditingUser(null);
       fetchUsers();
       showMessage('👤 Пользователь успешно обновлен!');
     } catch (error) {
       console.error('Error updating user:', error);
+      if (isConflict(error)) {
+        fetchUsers();
+        showMessage('⚠️ Пользователя уже изменили, обновите данные и повторите', 'error');
+        return;
+      }
       showMessage('❌ Ошибка при обновлении пользователя', 'error');
     }
   };
@@ -201,12 +231,18 @@ function App() {
   const updateTask = async (e) => {
     e.preventDefault();
     try {
-      await axios.put(`${API_URL}/tasks/${editingTask.id}`, editingTask);
+      const original = tasks.find(task => task.id === editingTask.id) || {};
+      await patchChanges(`${API_URL}/tasks/${editingTask.id}`, original, editingTask, TASK_FIELDS);
       setEditingTask(null);
       fetchTasks();
       showMessage('✅ Задача успешно обновлена!');
     } catch (error) {
       console.error('Error updating task:', error);
+      if (isConflict(error)) {
+        fetchTasks();
+        showMessage('⚠️ Задачу уже изменили, обновите данные и повторите', 'error');
+        return;
+      }
       showMessage('❌ Ошибка при обновлении задачи', 'error');
     }
   };
@@ -214,12 +250,16 @@ function App() {
   const deleteUser = async (id) => {
     if (window.confirm('Вы уверены, что хотите удалить пользователя?')) {
       try {
-        await axios.delete(`${API_URL}/users/${id}`);
+        const user = users.find(user => user.id === id);
+        await axios.delete(`${API_URL}/users/${id}`, { headers: ifMatch(user) });
         fetchUsers();
         showMessage('👤 Пользователь удален!');
       } catch (error) {
         console.error('Error deleting user:', error);
-        showMessage('❌ Ошибка при удалении пользователя', 'error');
+        fetchUsers();
+        showMessage(isConflict(error)
+          ? '⚠️ Пользователя уже изменили, проверьте данные и повторите'
+          : '❌ Ошибка при удалении пользователя', 'error');
       }
     }
   };
@@ -227,12 +267,16 @@ function App() {
   const deleteTask = async (id) => {
     if (window.confirm('Вы уверены, что хотите удалить задачу?')) {
       try {
-        await axios.delete(`${API_URL}/tasks/${id}`);
+        const task = tasks.find(task => task.id === id);
+        await axios.delete(`${API_URL}/tasks/${id}`, { headers: ifMatch(task) });
         fetchTasks();
         showMessage('✅ Задача удалена!');
       } catch (error) {
         console.error('Error deleting task:', error);
-        showMessage('❌ Ошибка при удалении задачи', 'error');
+        fetchTasks();
+        showMessage(isConflict(error)
+          ? '⚠️ Задачу уже изменили, проверьте данные и повторите'
+          : '❌ Ошибка при удалении задачи', 'error');
       }
     }
   };
@@ -762,7 +806,6 @@ function App() {
                     >
                       <option value="pending">⏳ Ожидает</option>
                       <option value="in_progress">⚡ В работе</option>
-                      <option value="completed">✅ Завершена</option>
                     </select>
                   </div>
                   <div className="form-group">
@@ -816,7 +859,10 @@ function App() {
                     >
                       <option value="pending">⏳ Ожидает</option>
                       <option value="in_progress">⚡ В работе</option>
+                      <option value="review">🔍 На проверке</option>
+                      <option value="blocked">⛔ Заблокирована</option>
                       <option value="completed">✅ Завершена</option>
+                      <option value="cancelled">🚫 Отменена</option>
                     </select>
                   </div>
                   <div className="form-group">
@@ -893,7 +939,10 @@ function App() {
                         <div className="task-meta">
                           <span className={`status-badge status-${task.status}`}>
                             {task.status === 'pending' ? '⏳ Ожидает' : 
-                             task.status === 'in_progress' ? '⚡ В работе' : '✅ Завершена'}
+                             task.status === 'in_progress' ? '⚡ В работе' :
+                             task.status === 'review' ? '🔍 На проверке' :
+                             task.status === 'blocked' ? '⛔ Заблокирована' :
+                             task.status === 'cancelled' ? '🚫 Отменена' : '✅ Завершена'}
                           </span>
                           <span className={`priority-badge priority-${task.priority}`}>
                             {task.priority === 'high' ? '🔴 Высокий' : 